@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GroupBy is what Aggregate puts todos in the same bucket by: their Status,
+// or the day, week or month of a timestamp.
+type GroupBy string
+
+const (
+	GroupByStatus       GroupBy = "Status"
+	GroupByCreatedDay   GroupBy = "CreatedAt:day"
+	GroupByCreatedWeek  GroupBy = "CreatedAt:week"
+	GroupByCreatedMonth GroupBy = "CreatedAt:month"
+	GroupByUpdatedDay   GroupBy = "UpdatedAt:day"
+	GroupByUpdatedWeek  GroupBy = "UpdatedAt:week"
+	GroupByUpdatedMonth GroupBy = "UpdatedAt:month"
+)
+
+var groupBys = []GroupBy{
+	GroupByStatus,
+	GroupByCreatedDay, GroupByCreatedWeek, GroupByCreatedMonth,
+	GroupByUpdatedDay, GroupByUpdatedWeek, GroupByUpdatedMonth,
+}
+
+// Bucket summarizes the todos sharing a Key.
+type Bucket struct {
+	// Key holds a value for every GroupBy of the aggregation, in order: the
+	// status, or the first day of the day, week or month as 2006-01-02.
+	// Weeks start on Monday.
+	Key   []string
+	Count int
+	// Oldest and Newest are the earliest and latest CreatedAt of the bucket.
+	Oldest time.Time
+	Newest time.Time
+	// Completed counts the completed todos, and AverageCompletion is their
+	// average LeadTime.
+	Completed         int
+	AverageCompletion time.Duration
+}
+
+// Aggregate summarizes the todos of ops matching query in buckets, one per
+// combination of the values of groupBy that some todo has, ordered by Key.
+// Without groupBy there is a single bucket, unless no todo matches.
+//
+// Days, weeks and months start in the Location of the query, or else of the
+// store, or UTC, as whole days of the filter do. The todos are streamed
+// through the filter of query without being collected, and its sort is
+// ignored.
+func Aggregate(ctx context.Context, ops TodoOperations, query Query, groupBy ...GroupBy) ([]Bucket, error) {
+	if query.Workflow == nil {
+		query.Workflow = workflowOf(ops)
+	}
+	if query.Location == nil {
+		query.Location = locationOf(ops)
+	}
+	if err := typeCheckQuery(query); err != nil {
+		return nil, err
+	}
+	if err := checkGroupBy(groupBy); err != nil {
+		return nil, err
+	}
+
+	loc := query.dates(nil, nil).loc
+	query.SortBy, query.Sort = "", ""
+
+	buckets := make(map[string]*Bucket)
+	completion := make(map[string]time.Duration)
+
+	for entity, err := range ops.IterByFilter(ctx, query) {
+		if err != nil {
+			return nil, err
+		}
+
+		key := make([]string, len(groupBy))
+		for i, g := range groupBy {
+			key[i] = groupKey(&entity, g, loc)
+		}
+		id := strings.Join(key, "\x00")
+
+		bucket, ok := buckets[id]
+		if !ok {
+			bucket = &Bucket{Key: key, Oldest: entity.CreatedAt, Newest: entity.CreatedAt}
+			buckets[id] = bucket
+		}
+
+		bucket.Count++
+		if entity.CreatedAt.Before(bucket.Oldest) {
+			bucket.Oldest = entity.CreatedAt
+		}
+		if entity.CreatedAt.After(bucket.Newest) {
+			bucket.Newest = entity.CreatedAt
+		}
+		if leadTime, ok := entity.LeadTime(query.Workflow); ok {
+			bucket.Completed++
+			completion[id] += leadTime
+		}
+	}
+
+	result := make([]Bucket, 0, len(buckets))
+	for id, bucket := range buckets {
+		if bucket.Completed > 0 {
+			bucket.AverageCompletion = completion[id] / time.Duration(bucket.Completed)
+		}
+		result = append(result, *bucket)
+	}
+
+	slices.SortFunc(result, func(b1 Bucket, b2 Bucket) int {
+		return slices.Compare(b1.Key, b2.Key)
+	})
+
+	return result, nil
+}
+
+// AggregateByQuery is Aggregate for a query map. Its GroupBy key lists the
+// GroupBy values separated by commas, such as Status,CreatedAt:month.
+func AggregateByQuery(ctx context.Context, ops TodoOperations, query map[string]string) ([]Bucket, error) {
+	filters := make(map[string]string, len(query))
+	for qf, qv := range query {
+		if qf != "GroupBy" {
+			filters[qf] = qv
+		}
+	}
+
+	var groupBy []GroupBy
+	if value, ok := query["GroupBy"]; ok {
+		for _, g := range strings.Split(value, ",") {
+			groupBy = append(groupBy, GroupBy(g))
+		}
+	}
+
+	compiled, err := compileQuery(filters, workflowOf(ops))
+	if err != nil {
+		return nil, err
+	}
+
+	return Aggregate(ctx, ops, compiled, groupBy...)
+}
+
+func checkGroupBy(groupBy []GroupBy) error {
+	for i, g := range groupBy {
+		if !slices.Contains(groupBys, g) {
+			return &InvalidQueryError{Key: "GroupBy", Message: fmt.Sprintf("Invalid GroupBy %q, expected Status or CreatedAt or UpdatedAt with :day, :week or :month", g)}
+		}
+		if slices.Contains(groupBy[:i], g) {
+			return &InvalidQueryError{Key: "GroupBy", Message: fmt.Sprintf("Invalid GroupBy, %v is grouped by twice", g)}
+		}
+	}
+
+	return nil
+}
+
+// groupKey returns the value entity has for g.
+func groupKey(entity *TodoEntity, g GroupBy, loc *time.Location) string {
+	if g == GroupByStatus {
+		return string(entity.Status)
+	}
+
+	field, period, _ := strings.Cut(string(g), ":")
+
+	at := entity.CreatedAt
+	if field == "UpdatedAt" {
+		at = entity.UpdatedAt
+	}
+
+	start, _ := day(at, 0, loc)
+	switch period {
+	case "week":
+		// Weekday counts from Sunday; weeks start on Monday.
+		start, _ = day(start, -(int(start.Weekday())+6)%7, loc)
+	case "month":
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc)
+	}
+
+	return start.Format(time.DateOnly)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGroupKey(t *testing.T) {
+	local := time.FixedZone("UTC+9", 9*60*60)
+
+	tests := []struct {
+		at   time.Time
+		by   GroupBy
+		loc  *time.Location
+		want string
+	}{
+		{at: time.Date(2024, 11, 10, 23, 0, 0, 0, time.UTC), by: GroupByCreatedDay, loc: time.UTC, want: "2024-11-10"},
+		{at: time.Date(2024, 11, 10, 23, 0, 0, 0, time.UTC), by: GroupByCreatedDay, loc: local, want: "2024-11-11"},
+		{at: time.Date(2024, 11, 10, 12, 0, 0, 0, time.UTC), by: GroupByCreatedWeek, loc: time.UTC, want: "2024-11-04"},
+		{at: time.Date(2024, 11, 11, 12, 0, 0, 0, time.UTC), by: GroupByCreatedWeek, loc: time.UTC, want: "2024-11-11"},
+		{at: time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC), by: GroupByUpdatedWeek, loc: time.UTC, want: "2024-01-01"},
+		{at: time.Date(2024, 12, 1, 2, 0, 0, 0, time.UTC), by: GroupByCreatedWeek, loc: time.UTC, want: "2024-11-25"},
+		{at: time.Date(2024, 11, 30, 20, 0, 0, 0, time.UTC), by: GroupByCreatedMonth, loc: time.UTC, want: "2024-11-01"},
+		{at: time.Date(2024, 11, 30, 20, 0, 0, 0, time.UTC), by: GroupByCreatedMonth, loc: local, want: "2024-12-01"},
+	}
+
+	for _, tc := range tests {
+		entity := &TodoEntity{Entity: Entity{CreatedAt: tc.at, UpdatedAt: tc.at}}
+		if got := groupKey(entity, tc.by, tc.loc); got != tc.want {
+			t.Errorf("groupKey(%v, %v, %v) = %v, want %v", tc.at, tc.by, tc.loc, got, tc.want)
+		}
+	}
+}
@@ -2,25 +2,47 @@ package cmd
 
 import (
 	"cmp"
-	"errors"
+	"context"
 	"fmt"
-	"regexp"
+	"iter"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
 type TodoStatus string
 
+// The statuses of DefaultWorkflow.
 const (
-	StatusDone    TodoStatus = "Done"
-	StatusNotDone TodoStatus = "NotDone"
+	StatusDone       TodoStatus = "Done"
+	StatusNotDone    TodoStatus = "NotDone"
+	StatusInProgress TodoStatus = "InProgress"
+	StatusBlocked    TodoStatus = "Blocked"
+	StatusInReview   TodoStatus = "InReview"
+	StatusCancelled  TodoStatus = "Cancelled"
 )
 
 type Entity struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Id        string
+	// Version starts at 1 and is incremented by every update.
+	Version int64
+	// CompletedAt is when the todo entered a completed state of its
+	// workflow, such as Done. It is zero while the todo is not completed.
+	CompletedAt time.Time
+	// History lists the status changes of the todo, starting with the
+	// status it was inserted with.
+	History []StatusChange
+}
+
+// StatusChange records a todo moving to the To status at the time of the
+// Clock of its store. From is empty for the status a todo was inserted with.
+type StatusChange struct {
+	From TodoStatus
+	To   TodoStatus
+	At   time.Time
 }
 
 type Todo struct {
@@ -37,299 +59,615 @@ type GenerateId func() string
 
 type Clock func() time.Time
 
+type MutationOp string
+
+const (
+	MutationInsert MutationOp = "insert"
+	MutationUpdate MutationOp = "update"
+	MutationDelete MutationOp = "delete"
+)
+
+// Mutation is a single change to the TodoList. Entity holds the state of
+// the todo after an insert or update, and the removed todo on a delete.
+type Mutation struct {
+	Op     MutationOp
+	Entity TodoEntity
+}
+
+// Journal persists mutations before they are applied to the TodoList.
+// If it returns an error the mutations are discarded.
+type Journal func(mutations []Mutation) error
+
+// Audit is told about mutations once they are applied. ctx is the context
+// of the call that made them, so request-scoped values such as the actor
+// set by WithActor reach it.
+type Audit func(ctx context.Context, mutations []Mutation)
+
+// TodoRepository is safe for concurrent use. Reads share a read lock while
+// mutations hold the write lock until they are journaled and applied.
+//
+// Lookups by id and queries go through an index of the TodoList that is
+// built on first use and kept up to date by every write. TodoList may be
+// replaced, but must not be changed in place once the repository is in use.
+//
+// Location is the time zone whole days of queries start in, unless a Query
+// sets its own; nil means UTC.
 type TodoRepository struct {
 	GenerateId GenerateId
 	Clock      Clock
-	TodoList   []TodoEntity
+	Journal    Journal
+	Audit      Audit
+	Location   *time.Location
+	// Workflow is the state machine of the statuses; nil means
+	// DefaultWorkflow.
+	Workflow *Workflow
+	TodoList []TodoEntity
+
+	mu sync.RWMutex
+	// indexMu lets readers holding the read lock build idx.
+	indexMu sync.Mutex
+	idx     *todoIndex
 }
 
-func (r *TodoRepository) Insert(todo *Todo) (*TodoEntity, error) {
-	if len(todo.Description) == 0 {
-		return nil, errors.New("description is not valid, it must be a valid string")
+// applyMutations applies the mutations in order to todoList and returns the
+// resulting list.
+func applyMutations(todoList []TodoEntity, mutations []Mutation) []TodoEntity {
+	for _, m := range mutations {
+		idx := slices.IndexFunc(todoList, func(e TodoEntity) bool {
+			return e.Id == m.Entity.Id
+		})
+
+		switch m.Op {
+		case MutationInsert:
+			todoList = append(todoList, m.Entity)
+		case MutationUpdate:
+			if idx >= 0 {
+				todoList[idx] = m.Entity
+			}
+		case MutationDelete:
+			if idx >= 0 {
+				todoList = slices.Delete(todoList, idx, idx+1)
+			}
+		}
 	}
 
-	var status TodoStatus
-	if len(todo.Status) != 0 {
-		status = todo.Status
+	return todoList
+}
+
+// commit writes the mutations to the Journal, if any, applies them and
+// reports them to the Audit hook. Nothing is written once ctx is done.
+func (r *TodoRepository) commit(ctx context.Context, mutations ...Mutation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.Journal != nil {
+		if err := r.Journal(mutations); err != nil {
+			return err
+		}
+	}
+
+	if r.idx != nil && r.idx.covers(r.TodoList) {
+		r.TodoList = r.idx.apply(mutations)
 	} else {
-		status = StatusNotDone
+		r.TodoList = applyMutations(r.TodoList, mutations)
+	}
+
+	if r.Audit != nil {
+		r.Audit(ctx, mutations)
+	}
+
+	return nil
+}
+
+// newTodoEntity validates todo and builds the entity that will be stored.
+func newTodoEntity(todo *Todo, id string, now time.Time, workflow *Workflow) (*TodoEntity, error) {
+	checked, err := checkTodo(*todo, workflow)
+	if err != nil {
+		return nil, err
 	}
 
-	todoEntity := &TodoEntity{
+	entity := &TodoEntity{
 		Entity{
-			Id:        r.GenerateId(),
-			CreatedAt: r.Clock(),
-			UpdatedAt: r.Clock(),
-		},
-		Todo{
-			Description: todo.Description,
-			Status:      status,
+			Id:        id,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Version:   1,
 		},
+		checked,
+	}
+	workflow.record(entity, "", now)
+
+	return entity, nil
+}
+
+// checkTodo applies the rules of Insert to todo: the Description is
+// required and the Status must be a state of workflow, the first one if it
+// is empty.
+func checkTodo(todo Todo, workflow *Workflow) (Todo, error) {
+	if err := workflow.check(); err != nil {
+		return Todo{}, err
+	}
+
+	if len(todo.Description) == 0 {
+		return Todo{}, &ValidationError{
+			Field:   "Description",
+			Message: "description is not valid, it must be a valid string",
+		}
+	}
+
+	if len(todo.Status) == 0 {
+		todo.Status = workflow.States[0]
+	}
+
+	if err := workflow.checkStatus(todo.Status); err != nil {
+		return Todo{}, err
+	}
+
+	return todo, nil
+}
+
+func (r *TodoRepository) Insert(todo *Todo) (*TodoEntity, error) {
+	return r.InsertContext(context.Background(), todo)
+}
+
+func (r *TodoRepository) InsertContext(ctx context.Context, todo *Todo) (*TodoEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todoEntity, err := newTodoEntity(todo, r.GenerateId(), r.Clock(), r.workflow())
+	if err != nil {
+		return nil, err
 	}
 
 	// Insert the entity into the TodoList
-	r.TodoList = append(r.TodoList, *todoEntity)
+	if err := r.commit(ctx, Mutation{Op: MutationInsert, Entity: *todoEntity}); err != nil {
+		return nil, err
+	}
 
 	return todoEntity, nil
 }
 
 func (r *TodoRepository) FetchAll() ([]TodoEntity, error) {
-	if r.TodoList == nil {
-		return nil, errors.New("repository not initialized")
+	return r.FetchAllContext(context.Background())
+}
+
+func (r *TodoRepository) FetchAllContext(ctx context.Context) ([]TodoEntity, error) {
+	return collectTodos(r.IterAll(ctx))
+}
+
+// IterAll streams every todo in insertion order. The read lock is held
+// until the loop ends, so the loop body must not write to the repository.
+func (r *TodoRepository) IterAll(ctx context.Context) iter.Seq2[TodoEntity, error] {
+	return r.IterByQuery(ctx, map[string]string{})
+}
+
+// collectTodos drains seq into a slice, stopping at the first error.
+func collectTodos(seq iter.Seq2[TodoEntity, error]) ([]TodoEntity, error) {
+	result := make([]TodoEntity, 0)
+	for entity, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entity)
+	}
+
+	return result, nil
+}
+
+// index returns the index of the TodoList, building it if the TodoList was
+// replaced since. The caller must hold a lock.
+func (r *TodoRepository) index() *todoIndex {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	if r.idx == nil || !r.idx.covers(r.TodoList) {
+		r.idx = buildTodoIndex(r.TodoList)
 	}
-	return r.TodoList, nil
+
+	return r.idx
+}
+
+// indexOf returns the position of the todo with id in the TodoList, or -1.
+func (r *TodoRepository) indexOf(id string) int {
+	return r.index().first(id)
 }
 
 func (r *TodoRepository) filterById(id string) *TodoEntity {
-	index := slices.IndexFunc(r.TodoList, func(todoEntity TodoEntity) bool {
-		return todoEntity.Id == id
-	})
+	index := r.indexOf(id)
 
-	if index > 0 {
+	if index >= 0 {
 		return &r.TodoList[index]
 	} else {
 		return nil
 	}
 }
 
+// filterString reports whether field matches the regular expression value.
+// Patterns are compiled once through the regex cache.
 func filterString(field string, value string) bool {
-	match, err := regexp.MatchString(value, field)
+	re, err := compileRegex(value)
 	if err != nil {
 		return false
 	}
 
-	return match
+	return re.MatchString(field)
 }
 
-func filterDate(field time.Time, value time.Time) bool {
-	truncField := field.Truncate(time.Hour * 24)
-	truncValue := value.Truncate(time.Hour * 24)
+// validateQuery checks a query map, with the Status values of workflow.
+func validateQuery(query map[string]string, workflow *Workflow) error {
+	for qf, qv := range query {
+		if qf == "Sort" || qf == "SortBy" {
+			continue
+		}
+
+		field, op := splitQueryKey(qf)
+		message, opErr := checkFieldFilter(FieldFilter{Field: field, Op: op, Value: qv}, workflow)
+		if opErr {
+			return &InvalidQueryError{Key: qf, Message: fmt.Sprintf("Invalid query field. Got %v", qf)}
+		}
+		if message != "" {
+			return &InvalidQueryError{Key: qf, Message: message}
+		}
+	}
+
+	sortBy, hasSortBy := query["SortBy"]
+	sort, hasSort := query["Sort"]
 
-	return truncField.Equal(truncValue)
+	return checkSort(sortBy, hasSortBy, sort, hasSort)
 }
 
-func validateQuery(query map[string]string) error {
+func matchQuery(entity *TodoEntity, query map[string]string, dc dateContext) bool {
+	if entity == nil {
+		return false
+	}
+
+	isMatch := true
+
 	for qf, qv := range query {
-		switch qf {
+		field, op := splitQueryKey(qf)
+		isMatch = isMatch && matchField(entity, field, op, qv, dc)
+	}
+
+	return isMatch
+}
+
+// queryKeySuffixes maps the suffix of a query key to its operator; a key
+// without one, such as Status, compares for equality.
+var queryKeySuffixes = map[string]FilterOp{
+	"_lt":       OpLt,
+	"_lte":      OpLte,
+	"_gt":       OpGt,
+	"_gte":      OpGte,
+	"_between":  OpBetween,
+	"_contains": OpContains,
+	"_prefix":   OpPrefix,
+	"_ieq":      OpEqualFold,
+	"_regex":    OpRegex,
+}
+
+// splitQueryKey splits a query key such as CreatedAt_lt into its field and
+// operator.
+func splitQueryKey(key string) (string, FilterOp) {
+	for suffix, op := range queryKeySuffixes {
+		if field, ok := strings.CutSuffix(key, suffix); ok {
+			return field, op
+		}
+	}
+
+	return key, OpEq
+}
+
+// matchString compares a string field with value using op.
+func matchString(field string, op FilterOp, value string) bool {
+	switch op {
+	case OpContains:
+		return strings.Contains(field, value)
+	case OpPrefix:
+		return strings.HasPrefix(field, value)
+	case OpEqualFold:
+		return strings.EqualFold(field, value)
+	case OpRegex:
+		return filterString(field, value)
+	default:
+		return field == value
+	}
+}
+
+// matchField compares a field of entity with value using op. It is the
+// engine behind both query maps and Filter trees. Fields it does not know,
+// such as Sort and SortBy, always match. dc resolves the time values of
+// CreatedAt and UpdatedAt.
+func matchField(entity *TodoEntity, field string, op FilterOp, value string, dc dateContext) bool {
+	switch field {
+	case "Id":
+		return entity.Id == value
+	case "CreatedAt", "UpdatedAt":
+		at := entity.CreatedAt
+		if field == "UpdatedAt" {
+			at = entity.UpdatedAt
+		}
+
+		span, ok := filterSpan(op, value, dc)
+		return ok && span.contains(at)
+	case "Description":
+		return matchString(entity.Description, op, value)
+	case "Status":
+		return string(entity.Status) == value
+	}
+
+	return true
+}
+
+// sortQuery orders two todos by keys: the first key they differ on decides.
+// Timestamps are compared exactly.
+func sortQuery(entity1 *TodoEntity, entity2 *TodoEntity, keys []sortKey) int {
+	for _, key := range keys {
+		c := 0
+		switch key.field {
 		case "Id":
-			continue
+			c = cmp.Compare(entity1.Id, entity2.Id)
 		case "CreatedAt":
+			c = entity1.CreatedAt.Compare(entity2.CreatedAt)
 		case "UpdatedAt":
-		case "CreatedAt_lt":
-		case "UpdatedAt_lt":
-		case "CreatedAt_gt":
-		case "UpdatedAt_gt":
-			// Check if is valid format. YYYY-MM-dd
-			_, err := time.Parse("YYY-MM-dd", qv)
-			if err != nil {
-				return fmt.Errorf("Invalid time format %e", err)
-			}
+			c = entity1.UpdatedAt.Compare(entity2.UpdatedAt)
 		case "Description":
-			continue
+			c = cmp.Compare(entity1.Description, entity2.Description)
 		case "Status":
-			if qv != string(StatusDone) && qv != string(StatusNotDone) {
-				return fmt.Errorf("Invalid Status query value")
-			}
-			continue
-		case "Sort":
-			if qv != "asc" && qv != "desc" {
-				return fmt.Errorf("Invalid Status query value")
-			}
-			continue
-		case "SortBy":
-			if qv != "Id" && qv != "CreatedAt" && qv != "UpdatedAt" && qv != "Description" {
-				return fmt.Errorf("Invalid sort, sort by only accepts Id, CreatedAt, UpdatedAt, Description")
-			}
-			continue
-		default:
-			return fmt.Errorf("Invalid query field. Got %v", qf)
+			c = cmp.Compare(entity1.Status, entity2.Status)
+		}
+
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
 		}
 	}
 
-	_, hasSort := query["Sort"]
-	_, hasSortBy := query["SortBy"]
+	return 0
+}
 
-	if hasSort && !hasSortBy {
-		return fmt.Errorf("If the query has a sort, then the field must be defined by SortBy")
-	}
+func (r *TodoRepository) FetchByQuery(query map[string]string) ([]TodoEntity, error) {
+	return r.FetchByQueryContext(context.Background(), query)
+}
 
-	if hasSortBy && !hasSort {
-		return fmt.Errorf("If the query has a sort by a field, then the direction must be defined by Sort")
-	}
+// cancelCheckEvery is how many todos a scan visits between checks of its
+// context.
+const cancelCheckEvery = 1024
 
-	return nil
+func (r *TodoRepository) FetchByQueryContext(ctx context.Context, query map[string]string) ([]TodoEntity, error) {
+	return collectTodos(r.IterByQuery(ctx, query))
 }
 
-// matchDate takes two arguments and compares then.
-// will return 0 if both are equal
-// will return 1 if d1 > d2
-// will return -1 if d1 < d2
-func matchDate(d1 time.Time, d2 time.Time) int {
-	d1Trunc := d1.Truncate(24 * time.Hour)
-	d2Trunc := d2.Truncate(24 * time.Hour)
+// IterByQuery streams the todos matching query. Without a sort they are
+// yielded as the scan finds them; a sorted query gathers and sorts the
+// matches first. Like IterAll, the loop body must not write to the
+// repository.
+func (r *TodoRepository) IterByQuery(ctx context.Context, query map[string]string) iter.Seq2[TodoEntity, error] {
+	compiled, err := compileQuery(query, r.workflow())
+	return r.iterQuery(ctx, compiled, err)
+}
 
-	return d1Trunc.Compare(d2Trunc)
+func (r *TodoRepository) FetchByFilter(query Query) ([]TodoEntity, error) {
+	return r.FetchByFilterContext(context.Background(), query)
 }
 
-var (
-	createdAtRegex = regexp.MustCompile(`CreatedAt`)
-	updatedAtRegex = regexp.MustCompile(`UpdatedAt`)
-)
+func (r *TodoRepository) FetchByFilterContext(ctx context.Context, query Query) ([]TodoEntity, error) {
+	return collectTodos(r.IterByFilter(ctx, query))
+}
 
-func matchQuery(entity *TodoEntity, query map[string]string) bool {
-	if entity == nil {
-		return false
+// IterByFilter is IterByQuery for a filter tree.
+func (r *TodoRepository) IterByFilter(ctx context.Context, query Query) iter.Seq2[TodoEntity, error] {
+	if query.Workflow == nil {
+		query.Workflow = r.workflow()
 	}
 
-	isMatch := true
+	return r.iterQuery(ctx, query, typeCheckQuery(query))
+}
 
-	for qf, qv := range query {
-		switch field := qf; {
-		case field == "Id":
-			isMatch = isMatch && entity.Id == qv
-		case createdAtRegex.MatchString(field):
-			qvDate, _ := time.Parse("2006-01-02", qv)
-			res := matchDate(entity.CreatedAt, qvDate)
-			if strings.HasSuffix(qf, "_lt") {
-				isMatch = isMatch && res < 0
-			} else if strings.HasSuffix(qf, "_gt") {
-				isMatch = isMatch && res > 0
-			} else {
-				isMatch = isMatch && res == 0
-			}
-		case updatedAtRegex.MatchString(field):
-			qvDate, _ := time.Parse("2006-01-02", qv)
-			res := matchDate(entity.UpdatedAt, qvDate)
-			if strings.HasSuffix(qf, "_lt") {
-				isMatch = isMatch && res < 0
-			} else if strings.HasSuffix(qf, "_gt") {
-				isMatch = isMatch && res > 0
-			} else {
-				isMatch = isMatch && res == 0
-			}
-		case field == "Description":
-			isMatch = isMatch && entity.Description == qv
-		case field == "Status":
-			isMatch = isMatch && string(entity.Status) == qv
+// iterQuery streams the todos matching query, or yields queryErr, the
+// outcome of validating it.
+func (r *TodoRepository) iterQuery(ctx context.Context, query Query, queryErr error) iter.Seq2[TodoEntity, error] {
+	return func(yield func(TodoEntity, error) bool) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		if r.TodoList == nil {
+			yield(TodoEntity{}, ErrNotInitialized)
+			return
 		}
-	}
 
-	return isMatch
-}
+		if queryErr != nil {
+			yield(TodoEntity{}, queryErr)
+			return
+		}
 
-func sortQuery(entity1 *TodoEntity, entity2 *TodoEntity, sortBy string, order string) int {
-	switch sortBy {
-	case "Id":
-		c := cmp.Compare(entity1.Id, entity2.Id)
-		if order == "asc" {
-			return c
-		} else {
-			return -c
+		dc := query.dates(r.Clock, r.Location)
+		query.Filter = query.Workflow.orDefault().expand(query.Filter)
+
+		// Without an index for the filter every todo is a candidate.
+		var positions []int
+		indexed := false
+		if indexable(query.Filter) {
+			positions, indexed = r.index().plan(query.Filter, dc)
 		}
-	case "CreatedAt":
-		c := matchDate(entity1.CreatedAt, entity2.CreatedAt)
-		if order == "asc" {
-			return c
-		} else {
-			return -c
+
+		candidates := len(r.TodoList)
+		if indexed {
+			candidates = len(positions)
 		}
-	case "UpdatedAt":
-		c := matchDate(entity1.UpdatedAt, entity2.UpdatedAt)
-		if order == "asc" {
-			return c
-		} else {
-			return -c
+
+		var sorted []TodoEntity
+		for i := 0; i < candidates; i++ {
+			if i%cancelCheckEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					yield(TodoEntity{}, err)
+					return
+				}
+			}
+
+			p := i
+			if indexed {
+				p = positions[i]
+			}
+
+			t := r.TodoList[p]
+			if !matchFilter(&t, query.Filter, dc) {
+				continue
+			}
+
+			if query.SortBy != "" {
+				sorted = append(sorted, t)
+			} else if !yield(t, nil) {
+				return
+			}
 		}
-	case "Description":
-		c := cmp.Compare(entity1.Description, entity2.Description)
-		if order == "asc" {
-			return c
-		} else {
-			return -c
+
+		// Todos equal on every key stay in TodoList order.
+		keys := query.sortKeys()
+		slices.SortStableFunc(sorted, func(e1 TodoEntity, e2 TodoEntity) int {
+			return sortQuery(&e1, &e2, keys)
+		})
+
+		for _, t := range sorted {
+			if !yield(t, nil) {
+				return
+			}
 		}
 	}
-	return 0
 }
 
-func (r *TodoRepository) FetchByQuery(query map[string]string) ([]TodoEntity, error) {
-	if r.TodoList == nil {
-		return nil, errors.New("repostitory not initialized")
+// validateUpdate verifies model consistency.
+func validateUpdate(model Todo) error {
+	if model.Status == "" && model.Description == "" {
+		return &ValidationError{
+			Field:   "Todo",
+			Message: "At least one field Status or Description must be filled",
+		}
+	}
+
+	return nil
+}
+
+// updateTodoEntity copies the filled fields of model into entity, if
+// workflow allows its change of status, and records that change.
+func updateTodoEntity(entity TodoEntity, model Todo, now time.Time, workflow *Workflow) (TodoEntity, error) {
+	if err := workflow.check(); err != nil {
+		return TodoEntity{}, err
 	}
 
-	// Validate the query.
-	queryErr := validateQuery(query)
-	if queryErr != nil {
-		return nil, queryErr
+	next := entity
+
+	// A todo stored before completions were recorded keeps its last update
+	// as its completion, which this update would otherwise move.
+	if entity.History == nil && entity.CompletedAt.IsZero() && slices.Contains(workflow.Completed, entity.Status) {
+		next.CompletedAt = entity.UpdatedAt
 	}
 
-	sortDirection, hasSort := query["Sort"]
-	sortField := query["SortBy"]
+	if model.Status != "" {
+		next.Status = model.Status
+	}
 
-	result := make([]TodoEntity, 0)
-	for _, t := range r.TodoList {
-		if matchQuery(&t, query) {
-			result = append(result, t)
-		}
+	if model.Description != "" {
+		next.Description = model.Description
 	}
 
-	if hasSort && len(result) > 0 {
-		slices.SortFunc(result, func(e1 TodoEntity, e2 TodoEntity) int {
-			return sortQuery(&e1, &e2, sortField, sortDirection)
-		})
+	next.UpdatedAt = now
+	next.Version++
+
+	if err := workflow.transition(&entity, &next); err != nil {
+		return TodoEntity{}, err
 	}
 
-	return result, nil
+	if next.Status != entity.Status {
+		workflow.record(&next, entity.Status, now)
+	}
+
+	return next, nil
+}
+
+func (r *TodoRepository) workflow() *Workflow {
+	return r.Workflow.orDefault()
+}
+
+func (r *TodoRepository) location() *time.Location {
+	return r.Location
 }
 
 func (r *TodoRepository) Update(id string, model Todo) (*TodoEntity, error) {
+	return r.update(context.Background(), id, model, anyVersion)
+}
+
+func (r *TodoRepository) UpdateContext(ctx context.Context, id string, model Todo) (*TodoEntity, error) {
+	return r.update(ctx, id, model, anyVersion)
+}
+
+func (r *TodoRepository) update(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if r.TodoList == nil {
-		return nil, errors.New("repository not initialized")
+		return nil, ErrNotInitialized
 	}
 
-	// Verify model consistency.
-	if model.Status == "" && model.Description == "" {
-		return nil, errors.New("At least one field Status or Description must be filled")
+	if err := validateUpdate(model); err != nil {
+		return nil, err
 	}
 
-	idx := slices.IndexFunc(r.TodoList, func(e TodoEntity) bool {
-		return e.Id == id
-	})
+	idx := r.indexOf(id)
 
 	if idx < 0 {
-		return nil, fmt.Errorf("Entity with id %v was not found", id)
+		return nil, &NotFoundError{Id: id}
 	}
 
-	entity := r.TodoList[idx]
-
-	if model.Status != "" {
-		entity.Status = model.Status
+	if err := checkVersion(&r.TodoList[idx], expectedVersion); err != nil {
+		return nil, err
 	}
 
-	if model.Description != "" {
-		entity.Description = model.Description
+	entity, err := updateTodoEntity(r.TodoList[idx], model, r.Clock(), r.workflow())
+	if err != nil {
+		return nil, err
 	}
 
-	entity.UpdatedAt = r.Clock()
+	if err := r.commit(ctx, Mutation{Op: MutationUpdate, Entity: entity}); err != nil {
+		return nil, err
+	}
 
 	return &entity, nil
 }
 
 func (r *TodoRepository) Delete(id string) (*TodoEntity, error) {
+	return r.delete(context.Background(), id, anyVersion)
+}
+
+func (r *TodoRepository) DeleteContext(ctx context.Context, id string) (*TodoEntity, error) {
+	return r.delete(ctx, id, anyVersion)
+}
+
+func (r *TodoRepository) delete(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if r.TodoList == nil {
-		return nil, errors.New("repository not initialized")
+		return nil, ErrNotInitialized
 	}
 
-	idx := slices.IndexFunc(r.TodoList, func(e TodoEntity) bool {
-		return e.Id == id
-	})
+	idx := r.indexOf(id)
 
 	if idx < 0 {
-		return nil, fmt.Errorf("Entity with id %v was not found", id)
+		return nil, &NotFoundError{Id: id}
 	}
 
 	entity := r.TodoList[idx]
 
-	r.TodoList = slices.Delete(r.TodoList, idx, idx)
+	if err := checkVersion(&entity, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if err := r.commit(ctx, Mutation{Op: MutationDelete, Entity: entity}); err != nil {
+		return nil, err
+	}
 
 	return &entity, nil
 }
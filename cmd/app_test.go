@@ -37,9 +37,12 @@ func TestInsert(t *testing.T) {
 			},
 			want: &TodoEntity{
 				Entity{
-					Id:        "123",
-					CreatedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
-					UpdatedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					Id:          "123",
+					CreatedAt:   time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					UpdatedAt:   time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					Version:     1,
+					CompletedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					History:     []StatusChange{{To: StatusDone, At: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC)}},
 				},
 				Todo{
 					Description: "Todo Description",
@@ -69,6 +72,8 @@ func TestInsert(t *testing.T) {
 					Id:        "123",
 					CreatedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
 					UpdatedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					Version:   1,
+					History:   []StatusChange{{To: StatusNotDone, At: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC)}},
 				},
 				Todo{
 					Description: "No Status",
@@ -96,9 +101,10 @@ func TestInsert(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tests {
+	for i := range tests {
+		tc := &tests[i]
 		t.Run(tc.name, func(t *testing.T) {
-			repository := tc.fields
+			repository := &tc.fields
 
 			got, err := repository.Insert(tc.args.todo)
 			if (err != nil) != tc.wantErr {
@@ -174,7 +180,8 @@ func TestFetchAll(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tests {
+	for i := range tests {
+		tc := &tests[i]
 		t.Run(tc.name, func(t *testing.T) {
 			repository := &tc.fields
 
@@ -479,9 +486,10 @@ func TestFetchQuery(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tests {
+	for i := range tests {
+		tc := &tests[i]
 		t.Run(tc.name, func(t *testing.T) {
-			repository := tc.fields
+			repository := &tc.fields
 
 			got, err := repository.FetchByQuery(tc.args)
 
@@ -549,6 +557,7 @@ func TestUpdate(t *testing.T) {
 				Entity{
 					Id:        "1234",
 					UpdatedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					Version:   1,
 				},
 				Todo{
 					Description: "New Description",
@@ -593,6 +602,8 @@ func TestUpdate(t *testing.T) {
 				Entity{
 					Id:        "1234",
 					UpdatedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+					Version:   1,
+					History:   []StatusChange{{From: StatusDone, To: StatusNotDone, At: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC)}},
 				},
 				Todo{
 					Description: "Description 1234",
@@ -668,9 +679,10 @@ func TestUpdate(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tests {
+	for i := range tests {
+		tc := &tests[i]
 		t.Run(tc.name, func(t *testing.T) {
-			repository := tc.fields
+			repository := &tc.fields
 
 			got, err := repository.Update(tc.args.id, tc.args.model)
 
@@ -768,9 +780,10 @@ func TestDelete(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tests {
+	for i := range tests {
+		tc := &tests[i]
 		t.Run(tc.name, func(t *testing.T) {
-			repository := tc.fields
+			repository := &tc.fields
 
 			got, err := repository.Delete(tc.args.id)
 
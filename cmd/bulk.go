@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+)
+
+// BulkResult reports the todos a bulk operation changed, or would change in
+// a dry run.
+type BulkResult struct {
+	Count int
+	Ids   []string
+	// Todos holds the todos as updated, or as they were before being
+	// deleted, in the order of the query.
+	Todos []TodoEntity
+}
+
+// UpdateByQuery applies the filled fields of patch, like Update does, to
+// every todo of store matching the query map. The updates are made in a
+// single transaction: either every match is updated or none is. A dry run
+// makes them in the transaction and rolls it back, so the result tells what
+// would change.
+func UpdateByQuery(ctx context.Context, store TodoStore, query map[string]string, patch Todo, dryRun bool) (*BulkResult, error) {
+	compiled, err := compileQuery(query, workflowOf(store))
+	if err != nil {
+		return nil, err
+	}
+
+	return UpdateByFilter(ctx, store, compiled, patch, dryRun)
+}
+
+// UpdateByFilter is UpdateByQuery for a filter tree.
+func UpdateByFilter(ctx context.Context, store TodoStore, query Query, patch Todo, dryRun bool) (*BulkResult, error) {
+	if err := validateUpdate(patch); err != nil {
+		return nil, err
+	}
+
+	return bulk(ctx, store, query, dryRun, func(tx TodoTx, entity *TodoEntity) (*TodoEntity, error) {
+		return tx.UpdateIfVersionContext(ctx, entity.Id, patch, entity.Version)
+	})
+}
+
+// DeleteByQuery deletes every todo of store matching the query map in a
+// single transaction, or only reports what it would delete in a dry run.
+func DeleteByQuery(ctx context.Context, store TodoStore, query map[string]string, dryRun bool) (*BulkResult, error) {
+	compiled, err := compileQuery(query, workflowOf(store))
+	if err != nil {
+		return nil, err
+	}
+
+	return DeleteByFilter(ctx, store, compiled, dryRun)
+}
+
+// DeleteByFilter is DeleteByQuery for a filter tree.
+func DeleteByFilter(ctx context.Context, store TodoStore, query Query, dryRun bool) (*BulkResult, error) {
+	return bulk(ctx, store, query, dryRun, func(tx TodoTx, entity *TodoEntity) (*TodoEntity, error) {
+		return tx.DeleteIfVersionContext(ctx, entity.Id, entity.Version)
+	})
+}
+
+// bulk runs write on every todo matching query inside a transaction, which
+// it commits unless dryRun is set. A commit conflicting with a concurrent
+// write fails with a *VersionConflictError and changes nothing.
+func bulk(ctx context.Context, store TodoStore, query Query, dryRun bool, write func(tx TodoTx, entity *TodoEntity) (*TodoEntity, error)) (*BulkResult, error) {
+	tx, err := store.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A dry run and a failed write roll back; after Commit it is a no-op.
+	defer tx.Rollback()
+
+	// The matches are read before writing, as the loop body of an iterator
+	// must not write.
+	matches, err := tx.FetchByFilterContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BulkResult{Ids: make([]string, 0, len(matches)), Todos: make([]TodoEntity, 0, len(matches))}
+	for i := range matches {
+		entity, err := write(tx, &matches[i])
+		if err != nil {
+			return nil, err
+		}
+		result.Ids = append(result.Ids, entity.Id)
+		result.Todos = append(result.Todos, *entity)
+	}
+	result.Count = len(result.Ids)
+
+	if dryRun {
+		return result, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the user acting on the store, for
+// Audit hooks to read with ActorFromContext.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, if any.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
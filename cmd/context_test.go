@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type auditEntry struct {
+	actor string
+	op    MutationOp
+	id    string
+}
+
+func recordAudit(entries *[]auditEntry) Audit {
+	return func(ctx context.Context, mutations []Mutation) {
+		actor, _ := ActorFromContext(ctx)
+		for _, m := range mutations {
+			*entries = append(*entries, auditEntry{actor: actor, op: m.Op, id: m.Entity.Id})
+		}
+	}
+}
+
+func testAuditActor(t *testing.T, store TodoStore) {
+	ctx := WithActor(context.Background(), "luccas")
+
+	inserted, err := store.InsertContext(ctx, &Todo{Description: "Audited"})
+	if err != nil {
+		t.Fatalf("InsertContext() error %v", err)
+	}
+	if _, err := store.UpdateContext(ctx, inserted.Id, Todo{Status: StatusDone}); err != nil {
+		t.Fatalf("UpdateContext() error %v", err)
+	}
+
+	tx, err := store.BeginContext(WithActor(context.Background(), "bot"))
+	if err != nil {
+		t.Fatalf("BeginContext() error %v", err)
+	}
+	if _, err := tx.Delete(inserted.Id); err != nil {
+		t.Fatalf("tx.Delete() error %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error %v", err)
+	}
+}
+
+func TestTodoRepositoryAudit(t *testing.T) {
+	var entries []auditEntry
+	r := &TodoRepository{
+		GenerateId: sequenceId(),
+		Clock:      fixedClock,
+		Audit:      recordAudit(&entries),
+		TodoList:   make([]TodoEntity, 0),
+	}
+
+	testAuditActor(t, r)
+
+	want := []auditEntry{
+		{actor: "luccas", op: MutationInsert, id: "1"},
+		{actor: "luccas", op: MutationUpdate, id: "1"},
+		{actor: "bot", op: MutationDelete, id: "1"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("audit entries = %v, want %v", entries, want)
+	}
+}
+
+func TestSQLStoreAudit(t *testing.T) {
+	var entries []auditEntry
+	store := openTestSQLStore(t, sequenceId(), fixedClock)
+	store.Audit = recordAudit(&entries)
+
+	testAuditActor(t, store)
+
+	want := []auditEntry{
+		{actor: "luccas", op: MutationInsert, id: "1"},
+		{actor: "luccas", op: MutationUpdate, id: "1"},
+		{actor: "bot", op: MutationDelete, id: "1"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("audit entries = %v, want %v", entries, want)
+	}
+}
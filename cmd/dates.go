@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateContext is what the time values of a filter are read against: now
+// anchors relative values such as today and -7d, and whole days start at
+// midnight in loc.
+type dateContext struct {
+	now time.Time
+	loc *time.Location
+}
+
+// dates returns the dateContext of q, taking clock and loc for the Now and
+// Location it leaves unset. Without those either, it is the current time in
+// UTC.
+func (q *Query) dates(clock Clock, loc *time.Location) dateContext {
+	dc := dateContext{now: q.Now, loc: q.Location}
+
+	if dc.now.IsZero() {
+		if clock != nil {
+			dc.now = clock()
+		} else {
+			dc.now = time.Now()
+		}
+	}
+
+	if dc.loc == nil {
+		dc.loc = loc
+	}
+	if dc.loc == nil {
+		dc.loc = time.UTC
+	}
+
+	return dc
+}
+
+// locationOf returns the Location of the store behind ops, which may be nil.
+func locationOf(ops TodoOperations) *time.Location {
+	if s, ok := ops.(interface{ location() *time.Location }); ok {
+		return s.location()
+	}
+
+	return nil
+}
+
+// timeSpan is the half-open interval [from, to) of instants a time
+// comparison allows. A bound that is not set leaves that side open.
+type timeSpan struct {
+	from, to       time.Time
+	hasFrom, hasTo bool
+}
+
+func (s timeSpan) contains(t time.Time) bool {
+	return (!s.hasFrom || !t.Before(s.from)) && (!s.hasTo || t.Before(s.to))
+}
+
+// intersect returns the instants both s and other allow.
+func (s timeSpan) intersect(other timeSpan) timeSpan {
+	if other.hasFrom && (!s.hasFrom || other.from.After(s.from)) {
+		s.from, s.hasFrom = other.from, true
+	}
+	if other.hasTo && (!s.hasTo || other.to.Before(s.to)) {
+		s.to, s.hasTo = other.to, true
+	}
+
+	return s
+}
+
+// filterSpan returns the instants a comparison of a timestamp with value
+// allows. Every value stands for a span of time, a whole day or a single
+// instant: = keeps the timestamps inside it, < and > the ones before and
+// after it, <= and >= include it, and between keeps everything from the
+// first value of "from..to" up to the end of the second one. ok is false
+// if the value or the operator are not valid.
+func filterSpan(op FilterOp, value string, dc dateContext) (timeSpan, bool) {
+	if op == OpBetween {
+		lo, hi, found := strings.Cut(value, "..")
+		if !found {
+			return timeSpan{}, false
+		}
+
+		from, _, okFrom := parseTimeValue(lo, dc)
+		_, to, okTo := parseTimeValue(hi, dc)
+
+		return timeSpan{from: from, to: to, hasFrom: true, hasTo: true}, okFrom && okTo
+	}
+
+	from, to, ok := parseTimeValue(value, dc)
+	if !ok {
+		return timeSpan{}, false
+	}
+
+	switch op {
+	case OpEq:
+		return timeSpan{from: from, to: to, hasFrom: true, hasTo: true}, true
+	case OpLt:
+		return timeSpan{to: from, hasTo: true}, true
+	case OpLte:
+		return timeSpan{to: to, hasTo: true}, true
+	case OpGt:
+		return timeSpan{from: to, hasFrom: true}, true
+	case OpGte:
+		return timeSpan{from: from, hasFrom: true}, true
+	}
+
+	return timeSpan{}, false
+}
+
+// relativeDays are the names of the days around now.
+var relativeDays = map[string]int{
+	"yesterday": -1,
+	"today":     0,
+	"tomorrow":  1,
+}
+
+// parseTimeValue returns the span [from, to) of the time value:
+//
+//   - a date such as 2024-11-10 is that whole day in dc.loc;
+//   - an RFC 3339 timestamp such as 2024-11-10T23:30:00-03:00 is that
+//     instant;
+//   - now is dc.now, and today, yesterday and tomorrow are whole days
+//     around it;
+//   - an offset from now such as -7d, +2w, -3h or -30m is a whole day when
+//     counted in days or weeks, and an instant otherwise.
+func parseTimeValue(value string, dc dateContext) (from time.Time, to time.Time, ok bool) {
+	if value == "now" {
+		return dc.now, dc.now.Add(time.Nanosecond), true
+	}
+
+	if offset, found := relativeDays[value]; found {
+		from, to = day(dc.now, offset, dc.loc)
+		return from, to, true
+	}
+
+	if len(value) > 2 && (value[0] == '-' || value[0] == '+') {
+		n, err := strconv.Atoi(value[1 : len(value)-1])
+		if err != nil || n < 0 {
+			return time.Time{}, time.Time{}, false
+		}
+		if value[0] == '-' {
+			n = -n
+		}
+
+		switch value[len(value)-1] {
+		case 'd':
+			from, to = day(dc.now, n, dc.loc)
+			return from, to, true
+		case 'w':
+			from, to = day(dc.now, 7*n, dc.loc)
+			return from, to, true
+		case 'h':
+			at := dc.now.Add(time.Duration(n) * time.Hour)
+			return at, at.Add(time.Nanosecond), true
+		case 'm':
+			at := dc.now.Add(time.Duration(n) * time.Minute)
+			return at, at.Add(time.Nanosecond), true
+		}
+
+		return time.Time{}, time.Time{}, false
+	}
+
+	if date, err := time.ParseInLocation(time.DateOnly, value, dc.loc); err == nil {
+		from, to = day(date, 0, dc.loc)
+		return from, to, true
+	}
+
+	if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return at, at.Add(time.Nanosecond), true
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+// day returns the start of the day offset days after the one of t in loc,
+// and the start of the day after it. Days are calendar days, so they last
+// 23 or 25 hours when the clocks change.
+func day(t time.Time, offset int, loc *time.Location) (time.Time, time.Time) {
+	y, m, d := t.In(loc).Date()
+
+	return time.Date(y, m, d+offset, 0, 0, 0, 0, loc), time.Date(y, m, d+offset+1, 0, 0, 0, 0, loc)
+}
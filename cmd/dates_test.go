@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestFilterSpan(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20:00 on November 2 in New York, the day before the clocks go back.
+	dc := dateContext{now: time.Date(2024, 11, 3, 0, 0, 0, 0, time.UTC), loc: newYork}
+	local := func(day int, hour int) time.Time { return time.Date(2024, 11, day, hour, 0, 0, 0, newYork) }
+	instant := time.Date(2024, 11, 10, 2, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		op     FilterOp
+		value  string
+		want   timeSpan
+		wantOk bool
+	}{
+		{op: OpEq, value: "2024-11-02", want: timeSpan{from: local(2, 0), to: local(3, 0), hasFrom: true, hasTo: true}, wantOk: true},
+		{op: OpEq, value: "today", want: timeSpan{from: local(2, 0), to: local(3, 0), hasFrom: true, hasTo: true}, wantOk: true},
+		{op: OpEq, value: "+1d", want: timeSpan{from: local(3, 0), to: local(4, 0), hasFrom: true, hasTo: true}, wantOk: true},
+		{op: OpLt, value: "yesterday", want: timeSpan{to: local(1, 0), hasTo: true}, wantOk: true},
+		{op: OpLte, value: "-1w", want: timeSpan{to: time.Date(2024, 10, 27, 0, 0, 0, 0, newYork), hasTo: true}, wantOk: true},
+		{op: OpGt, value: "tomorrow", want: timeSpan{from: local(4, 0), hasFrom: true}, wantOk: true},
+		{op: OpGte, value: "-3h", want: timeSpan{from: dc.now.Add(-3 * time.Hour), hasFrom: true}, wantOk: true},
+		{op: OpGt, value: "2024-11-10T02:30:00Z", want: timeSpan{from: instant.Add(time.Nanosecond), hasFrom: true}, wantOk: true},
+		{op: OpLt, value: "2024-11-09T23:30:00-03:00", want: timeSpan{to: instant, hasTo: true}, wantOk: true},
+		{op: OpEq, value: "now", want: timeSpan{from: dc.now, to: dc.now.Add(time.Nanosecond), hasFrom: true, hasTo: true}, wantOk: true},
+		{op: OpBetween, value: "2024-11-01..tomorrow", want: timeSpan{from: local(1, 0), to: local(4, 0), hasFrom: true, hasTo: true}, wantOk: true},
+		{op: OpBetween, value: "2024-11-01", wantOk: false},
+		{op: OpEq, value: "2024-11-01..2024-11-02", wantOk: false},
+		{op: OpEq, value: "soon", wantOk: false},
+		{op: OpEq, value: "-7", wantOk: false},
+		{op: OpEq, value: "--7d", wantOk: false},
+		{op: OpEq, value: "-7y", wantOk: false},
+		{op: OpContains, value: "today", wantOk: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.op)+tc.value, func(t *testing.T) {
+			got, ok := filterSpan(tc.op, tc.value, dc)
+			if ok != tc.wantOk {
+				t.Fatalf("filterSpan() ok = %v, want %v", ok, tc.wantOk)
+			}
+			sameSpan := got.hasFrom == tc.want.hasFrom && got.hasTo == tc.want.hasTo && got.from.Equal(tc.want.from) && got.to.Equal(tc.want.to)
+			if ok && !sameSpan {
+				t.Errorf("filterSpan() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	// The clocks go back on November 3, which lasts 25 hours.
+	from, to := day(local(3, 12), 0, newYork)
+	if to.Sub(from) != 25*time.Hour {
+		t.Errorf("day() = %v..%v, want 25 hours", from, to)
+	}
+}
+
+func TestStoreLocation(t *testing.T) {
+	local := time.FixedZone("UTC-3", -3*60*60)
+	lateNight := time.Date(2024, 11, 9, 23, 30, 0, 0, local)
+
+	repository := &TodoRepository{GenerateId: sequenceId(), Clock: func() time.Time { return lateNight }, TodoList: make([]TodoEntity, 0), Location: local}
+	sqlStore := openTestSQLStore(t, sequenceId(), func() time.Time { return lateNight })
+	sqlStore.Location = local
+
+	for name, store := range map[string]TodoStore{"TodoRepository": repository, "SQLStore": sqlStore} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Insert(&Todo{Description: "Late"}); err != nil {
+				t.Fatalf("Insert() error %v", err)
+			}
+
+			for _, query := range []map[string]string{{"CreatedAt": "2024-11-09"}, {"CreatedAt": "today"}} {
+				got, err := store.FetchByQuery(query)
+				if err != nil {
+					t.Fatalf("FetchByQuery(%v) error %v", query, err)
+				}
+				if len(got) != 1 {
+					t.Errorf("FetchByQuery(%v) = %v, want the todo created at 23:30 local time", query, got)
+				}
+			}
+
+			got, err := store.FetchByFilter(Query{Filter: Eq("CreatedAt", "2024-11-09"), Location: time.UTC})
+			if err != nil {
+				t.Fatalf("FetchByFilter() error %v", err)
+			}
+			if len(got) != 0 {
+				t.Errorf("FetchByFilter() in UTC = %v, want no todos", got)
+			}
+		})
+	}
+}
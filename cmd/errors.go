@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors matched with errors.Is. The structured errors below
+// match the sentinel of their kind and carry the details for errors.As.
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrValidation     = errors.New("validation failed")
+	ErrInvalidQuery   = errors.New("invalid query")
+	ErrConflict       = errors.New("conflict")
+	ErrNotInitialized = errors.New("repository not initialized")
+	ErrAmbiguous      = errors.New("ambiguous reference")
+	ErrInvalidPatch   = errors.New("invalid patch")
+)
+
+// NotFoundError is returned when no todo has the requested Id.
+type NotFoundError struct {
+	Id string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("Entity with id %v was not found", e.Id)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ValidationError is returned when a Todo field holds an invalid value.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// InvalidQueryError is returned when a query key or its value is not valid.
+// For a filter tree, Path locates the invalid node, such as Filter.Or[1].Not.
+type InvalidQueryError struct {
+	Key     string
+	Path    string
+	Message string
+}
+
+func (e *InvalidQueryError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%v: %v", e.Path, e.Message)
+	}
+	return e.Message
+}
+
+func (e *InvalidQueryError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
+
+// PatchError is returned when a patch document cannot be applied. For a
+// JSON Patch, Index, Op and Path locate the failing operation; Op is empty
+// for a merge patch.
+type PatchError struct {
+	Index   int
+	Op      string
+	Path    string
+	Message string
+}
+
+func (e *PatchError) Error() string {
+	if e.Op != "" {
+		return fmt.Sprintf("Operation %v (%v %q): %v", e.Index, e.Op, e.Path, e.Message)
+	}
+	return e.Message
+}
+
+func (e *PatchError) Is(target error) bool {
+	return target == ErrInvalidPatch
+}
+
+// TransitionError is returned when an update would move a todo between two
+// statuses its workflow does not connect, or Err, the error of a guard,
+// refused the transition.
+type TransitionError struct {
+	Id   string
+	From TodoStatus
+	To   TodoStatus
+	Err  error
+}
+
+func (e *TransitionError) Error() string {
+	message := fmt.Sprintf("Entity with id %v cannot go from status %v to %v", e.Id, e.From, e.To)
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", message, e.Err)
+	}
+	return message
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// VersionConflictError is returned by a conditional write when the entity
+// was changed since the caller read it.
+type VersionConflictError struct {
+	Id       string
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("Entity with id %v is at version %v, expected version %v", e.Id, e.Actual, e.Expected)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// DuplicateIdError is returned when a todo is written with an Id that is
+// already taken.
+type DuplicateIdError struct {
+	Id string
+}
+
+func (e *DuplicateIdError) Error() string {
+	return fmt.Sprintf("Entity with id %v already exists", e.Id)
+}
+
+func (e *DuplicateIdError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// AmbiguousIdError is returned by ResolveId when ref matches several todos
+// about as well. Candidates holds their Ids, best match first.
+type AmbiguousIdError struct {
+	Ref        string
+	Candidates []string
+}
+
+func (e *AmbiguousIdError) Error() string {
+	return fmt.Sprintf("Reference %q matches several entities: %v", e.Ref, strings.Join(e.Candidates, ", "))
+}
+
+func (e *AmbiguousIdError) Is(target error) bool {
+	return target == ErrAmbiguous
+}
+
+// QuerySyntaxError is returned by ParseQuery when the query text cannot be
+// parsed. Offset is the byte offset of the offending token and Column its
+// 1-based position in runes.
+type QuerySyntaxError struct {
+	Offset  int
+	Column  int
+	Message string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("Syntax error at column %v: %v", e.Column, e.Message)
+}
+
+func (e *QuerySyntaxError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTodoRepositoryErrors(t *testing.T) {
+	seeded := func() *TodoRepository {
+		return &TodoRepository{
+			GenerateId: sequenceId(),
+			Clock:      fixedClock,
+			TodoList:   conformanceSeed(),
+		}
+	}
+	uninitialized := func() *TodoRepository {
+		return &TodoRepository{
+			GenerateId: sequenceId(),
+			Clock:      fixedClock,
+		}
+	}
+
+	tests := []struct {
+		call   func(r *TodoRepository) error
+		repo   func() *TodoRepository
+		check  func(t *testing.T, err error)
+		target error
+		name   string
+	}{
+		{
+			name: "Insert without description",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.Insert(&Todo{})
+				return err
+			},
+			target: ErrValidation,
+			check: func(t *testing.T, err error) {
+				var validation *ValidationError
+				if !errors.As(err, &validation) || validation.Field != "Description" {
+					t.Errorf("error %v, want a *ValidationError on Description", err)
+				}
+			},
+		},
+		{
+			name: "FetchAll on an uninitialized repository",
+			repo: uninitialized,
+			call: func(r *TodoRepository) error {
+				_, err := r.FetchAll()
+				return err
+			},
+			target: ErrNotInitialized,
+		},
+		{
+			name: "FetchByQuery on an uninitialized repository",
+			repo: uninitialized,
+			call: func(r *TodoRepository) error {
+				_, err := r.FetchByQuery(map[string]string{})
+				return err
+			},
+			target: ErrNotInitialized,
+		},
+		{
+			name: "FetchByQuery with an unknown field",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.FetchByQuery(map[string]string{"Priority": "high"})
+				return err
+			},
+			target: ErrInvalidQuery,
+			check: func(t *testing.T, err error) {
+				var invalid *InvalidQueryError
+				if !errors.As(err, &invalid) || invalid.Key != "Priority" {
+					t.Errorf("error %v, want a *InvalidQueryError on Priority", err)
+				}
+			},
+		},
+		{
+			name: "FetchByQuery with an invalid date",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.FetchByQuery(map[string]string{"UpdatedAt_lt": "someday"})
+				return err
+			},
+			target: ErrInvalidQuery,
+			check: func(t *testing.T, err error) {
+				var invalid *InvalidQueryError
+				if !errors.As(err, &invalid) || invalid.Key != "UpdatedAt_lt" {
+					t.Errorf("error %v, want a *InvalidQueryError on UpdatedAt_lt", err)
+				}
+			},
+		},
+		{
+			name: "FetchByFilter with an invalid nested node",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.FetchByFilter(Query{Filter: Or(Eq("Id", "1234"), And(Not(Eq("Status", "Maybe"))))})
+				return err
+			},
+			target: ErrInvalidQuery,
+			check: func(t *testing.T, err error) {
+				var invalid *InvalidQueryError
+				if !errors.As(err, &invalid) || invalid.Path != "Filter.Or[1].And[0].Not" || invalid.Key != "Status" {
+					t.Errorf("error %v, want a *InvalidQueryError on Status at Filter.Or[1].And[0].Not", err)
+				}
+			},
+		},
+		{
+			name: "Update on an uninitialized repository",
+			repo: uninitialized,
+			call: func(r *TodoRepository) error {
+				_, err := r.Update("1234", Todo{Status: StatusDone})
+				return err
+			},
+			target: ErrNotInitialized,
+		},
+		{
+			name: "Update with an empty model",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.Update("1234", Todo{})
+				return err
+			},
+			target: ErrValidation,
+		},
+		{
+			name: "Update of an unknown id",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.Update("9999", Todo{Status: StatusDone})
+				return err
+			},
+			target: ErrNotFound,
+			check: func(t *testing.T, err error) {
+				var notFound *NotFoundError
+				if !errors.As(err, &notFound) || notFound.Id != "9999" {
+					t.Errorf("error %v, want a *NotFoundError for 9999", err)
+				}
+			},
+		},
+		{
+			name: "UpdateIfVersion with a stale version",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.UpdateIfVersion("1234", Todo{Status: StatusDone}, 7)
+				return err
+			},
+			target: ErrConflict,
+		},
+		{
+			name: "Delete on an uninitialized repository",
+			repo: uninitialized,
+			call: func(r *TodoRepository) error {
+				_, err := r.Delete("1234")
+				return err
+			},
+			target: ErrNotInitialized,
+		},
+		{
+			name: "Delete of an unknown id",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.Delete("9999")
+				return err
+			},
+			target: ErrNotFound,
+		},
+		{
+			name: "DeleteIfVersion with a stale version",
+			repo: seeded,
+			call: func(r *TodoRepository) error {
+				_, err := r.DeleteIfVersion("1234", 7)
+				return err
+			},
+			target: ErrConflict,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call(tc.repo())
+
+			if !errors.Is(err, tc.target) {
+				t.Fatalf("error %v, want errors.Is %v", err, tc.target)
+			}
+
+			if tc.check != nil {
+				tc.check(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// fileDocument is the JSON layout of a FileStore on disk.
+type fileDocument struct {
+	Todos []TodoEntity
+}
+
+// FileStore is a TodoRepository that keeps its TodoList in a JSON file.
+// Every mutation rewrites the whole file atomically.
+type FileStore struct {
+	*TodoRepository
+	Path string
+}
+
+var _ TodoStore = (*FileStore)(nil)
+
+// OpenFileStore loads the todos saved at path, or starts an empty list if
+// the file does not exist yet.
+func OpenFileStore(path string, generateId GenerateId, clock Clock) (*FileStore, error) {
+	todoList, err := loadFileDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{
+		TodoRepository: &TodoRepository{
+			GenerateId: generateId,
+			Clock:      clock,
+			TodoList:   todoList,
+		},
+		Path: path,
+	}
+	store.Journal = store.save
+
+	return store, nil
+}
+
+func (s *FileStore) save(mutations []Mutation) error {
+	todoList := applyMutations(slices.Clone(s.TodoList), mutations)
+	return saveFileDocument(s.Path, todoList)
+}
+
+func loadFileDocument(path string) ([]TodoEntity, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return make([]TodoEntity, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc fileDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Invalid todo file %v: %w", path, err)
+	}
+
+	if doc.Todos == nil {
+		doc.Todos = make([]TodoEntity, 0)
+	}
+
+	return doc.Todos, nil
+}
+
+func saveFileDocument(path string, todoList []TodoEntity) error {
+	if todoList == nil {
+		todoList = make([]TodoEntity, 0)
+	}
+
+	data, err := json.MarshalIndent(fileDocument{Todos: todoList}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path, so readers see either the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir flushes directory entries so a rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestFileStore(t *testing.T, generateId GenerateId, clock Clock, seed []TodoEntity) TodoStore {
+	path := filepath.Join(t.TempDir(), "todos.json")
+	if err := saveFileDocument(path, seed); err != nil {
+		t.Fatalf("saveFileDocument() error %v", err)
+	}
+
+	store, err := OpenFileStore(path, generateId, clock)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error %v", err)
+	}
+
+	return store
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	testTodoStore(t, newTestFileStore)
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.json")
+
+	store, err := OpenFileStore(path, fixedId, fixedClock)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error %v", err)
+	}
+
+	if _, err := store.Insert(&Todo{Description: "Persist me"}); err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+	if _, err := store.Update("123", Todo{Status: StatusDone}); err != nil {
+		t.Fatalf("Update() error %v", err)
+	}
+
+	want, _ := store.FetchAll()
+
+	reopened, err := OpenFileStore(path, fixedId, fixedClock)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error %v", err)
+	}
+
+	got, err := reopened.FetchAll()
+	if err != nil {
+		t.Fatalf("FetchAll() error %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchAll() after reopen = %v, want %v", got, want)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the todo file on disk, got %v", entries)
+	}
+}
+
+func TestFileStoreFailedWriteKeepsState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "todos.json")
+
+	store, err := OpenFileStore(path, fixedId, fixedClock)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error %v", err)
+	}
+
+	// Point the store at a directory that does not exist so saving fails.
+	store.Path = filepath.Join(dir, "missing", "todos.json")
+
+	if _, err := store.Insert(&Todo{Description: "Lost"}); err == nil {
+		t.Fatalf("Insert() expected an error")
+	}
+
+	got, _ := store.FetchAll()
+	if len(got) != 0 {
+		t.Errorf("FetchAll() after failed Insert = %v, want empty", got)
+	}
+}
+
+func TestOpenFileStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenFileStore(path, fixedId, fixedClock); err == nil {
+		t.Errorf("OpenFileStore() expected an error for a corrupt file")
+	}
+}
@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Query is a filter tree with an optional sort. SortBy and Sort hold the
+// same values as the keys of a query map. SortBy may list several fields,
+// such as Status,UpdatedAt,Id, which order the todos tied on the fields
+// before them; Sort then holds one direction for all of them or one per
+// field, such as asc,desc,asc.
+type Query struct {
+	Filter Filter
+	SortBy string
+	Sort   string
+	// Now is the time relative values such as today and -7d are counted
+	// from, and Location the time zone whole days start in. Stores fill the
+	// ones left unset from their Clock and Location.
+	Now      time.Time
+	Location *time.Location
+	// Workflow holds the states and groups a Status can be compared with.
+	// Stores fill it from their Workflow when it is unset.
+	Workflow *Workflow
+}
+
+// Match reports whether entity matches the filter of the query. Unset Now,
+// Location and Workflow are the current time, UTC and DefaultWorkflow.
+func (q *Query) Match(entity *TodoEntity) bool {
+	return matchFilter(entity, q.Workflow.orDefault().expand(q.Filter), q.dates(nil, nil))
+}
+
+// FilterOp is the comparison a FieldFilter makes.
+type FilterOp string
+
+const (
+	OpEq FilterOp = "="
+	// OpLt, OpLte, OpGt, OpGte and OpBetween compare CreatedAt and
+	// UpdatedAt with a time value: a date, which is a whole day, an RFC 3339
+	// timestamp, now, the days today, yesterday and tomorrow, or an offset
+	// from now such as -7d (a whole day), +2w, -3h or -30m. OpBetween takes
+	// two of them as "from..to" and includes both.
+	OpLt      FilterOp = "<"
+	OpLte     FilterOp = "<="
+	OpGt      FilterOp = ">"
+	OpGte     FilterOp = ">="
+	OpBetween FilterOp = ".."
+	// OpContains, OpPrefix, OpEqualFold and OpRegex match a Description
+	// holding Value, starting with it, equal to it ignoring case or matching
+	// the regular expression in it.
+	OpContains  FilterOp = "~"
+	OpPrefix    FilterOp = "^"
+	OpEqualFold FilterOp = "~="
+	OpRegex     FilterOp = "=~"
+)
+
+// Filter is a node of a filter tree. A nil Filter matches every todo.
+type Filter interface {
+	filterNode()
+}
+
+// AndFilter matches todos matched by all of Filters.
+type AndFilter struct {
+	Filters []Filter
+}
+
+// OrFilter matches todos matched by any of Filters.
+type OrFilter struct {
+	Filters []Filter
+}
+
+// NotFilter matches todos not matched by Filter.
+type NotFilter struct {
+	Filter Filter
+}
+
+// FieldFilter compares a todo field with Value. Field uses the names of the
+// query map keys: Id, Status, Description, CreatedAt and UpdatedAt. Dates
+// without a time are whole days in the Location of the query.
+type FieldFilter struct {
+	Field string
+	Op    FilterOp
+	Value string
+}
+
+// And, Or, Not and the comparison functions below build filter trees, for example
+//
+//	Or(And(Eq("Status", "Done"), Eq("CreatedAt", "2024-11-10")), Contains("Description", "urgent"))
+func And(filters ...Filter) AndFilter {
+	return AndFilter{Filters: filters}
+}
+
+func Or(filters ...Filter) OrFilter {
+	return OrFilter{Filters: filters}
+}
+
+func Not(filter Filter) NotFilter {
+	return NotFilter{Filter: filter}
+}
+
+func Eq(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpEq, Value: value}
+}
+
+func Lt(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpLt, Value: value}
+}
+
+func Lte(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpLte, Value: value}
+}
+
+func Gt(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpGt, Value: value}
+}
+
+func Gte(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpGte, Value: value}
+}
+
+func Between(field string, from string, to string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpBetween, Value: from + ".." + to}
+}
+
+func Contains(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpContains, Value: value}
+}
+
+func Prefix(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpPrefix, Value: value}
+}
+
+func EqualFold(field string, value string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpEqualFold, Value: value}
+}
+
+func Regex(field string, pattern string) FieldFilter {
+	return FieldFilter{Field: field, Op: OpRegex, Value: pattern}
+}
+
+func (AndFilter) filterNode()   {}
+func (OrFilter) filterNode()    {}
+func (NotFilter) filterNode()   {}
+func (FieldFilter) filterNode() {}
+
+// matchFilter evaluates filter against entity with the same engine as
+// matchQuery.
+func matchFilter(entity *TodoEntity, filter Filter, dc dateContext) bool {
+	switch f := filter.(type) {
+	case nil:
+		return true
+	case AndFilter:
+		for _, child := range f.Filters {
+			if !matchFilter(entity, child, dc) {
+				return false
+			}
+		}
+		return true
+	case OrFilter:
+		for _, child := range f.Filters {
+			if matchFilter(entity, child, dc) {
+				return true
+			}
+		}
+		return false
+	case NotFilter:
+		return !matchFilter(entity, f.Filter, dc)
+	case FieldFilter:
+		return matchField(entity, f.Field, f.Op, f.Value, dc)
+	}
+
+	return false
+}
+
+// queryFromMap turns a validated query map into a Query. Its filter ands
+// the comparisons in key order.
+func queryFromMap(query map[string]string) Query {
+	keys := make([]string, 0, len(query))
+	for qf := range query {
+		if qf != "Sort" && qf != "SortBy" {
+			keys = append(keys, qf)
+		}
+	}
+	slices.Sort(keys)
+
+	result := Query{SortBy: query["SortBy"], Sort: query["Sort"]}
+
+	if len(keys) > 0 {
+		filters := make([]Filter, len(keys))
+		for i, qf := range keys {
+			field, op := splitQueryKey(qf)
+			filters[i] = FieldFilter{Field: field, Op: op, Value: query[qf]}
+		}
+		result.Filter = AndFilter{Filters: filters}
+	}
+
+	return result
+}
+
+// compileQuery validates a query map against workflow and turns it into a
+// Query.
+func compileQuery(query map[string]string, workflow *Workflow) (Query, error) {
+	if err := validateQuery(query, workflow); err != nil {
+		return Query{}, err
+	}
+
+	compiled := queryFromMap(query)
+	compiled.Workflow = workflow
+
+	return compiled, nil
+}
+
+// typeCheckQuery walks the filter tree of query and checks every node. The
+// *InvalidQueryError it returns carries the Path of the invalid node.
+// Status values are checked against the Workflow of query, or DefaultWorkflow.
+func typeCheckQuery(query Query) error {
+	if err := typeCheckFilter(query.Filter, "Filter", query.Workflow.orDefault()); err != nil {
+		return err
+	}
+
+	return checkSort(query.SortBy, query.SortBy != "", query.Sort, query.Sort != "")
+}
+
+func typeCheckFilter(filter Filter, path string, workflow *Workflow) error {
+	switch f := filter.(type) {
+	case nil:
+		if path != "Filter" {
+			return &InvalidQueryError{Path: path, Message: "Missing filter"}
+		}
+	case AndFilter:
+		for i, child := range f.Filters {
+			if err := typeCheckFilter(child, fmt.Sprintf("%v.And[%d]", path, i), workflow); err != nil {
+				return err
+			}
+		}
+	case OrFilter:
+		for i, child := range f.Filters {
+			if err := typeCheckFilter(child, fmt.Sprintf("%v.Or[%d]", path, i), workflow); err != nil {
+				return err
+			}
+		}
+	case NotFilter:
+		return typeCheckFilter(f.Filter, path+".Not", workflow)
+	case FieldFilter:
+		if message, _ := checkFieldFilter(f, workflow); message != "" {
+			return &InvalidQueryError{Key: queryKey(f), Path: path, Message: message}
+		}
+	default:
+		return &InvalidQueryError{Path: path, Message: fmt.Sprintf("Unsupported filter node %T", filter)}
+	}
+
+	return nil
+}
+
+// queryKey returns the query map key of a comparison, such as CreatedAt_lt.
+func queryKey(f FieldFilter) string {
+	for suffix, op := range queryKeySuffixes {
+		if op == f.Op {
+			return f.Field + suffix
+		}
+	}
+
+	return f.Field
+}
+
+// checkFieldFilter type-checks a comparison and describes what is wrong
+// with it, if anything. opErr reports a field and operator that don't go
+// together rather than a bad value. A Status is a state or a group of
+// workflow.
+func checkFieldFilter(f FieldFilter, workflow *Workflow) (message string, opErr bool) {
+	switch f.Field {
+	case "Id":
+		if f.Op != OpEq {
+			return fmt.Sprintf("Invalid operator %v for Id", f.Op), true
+		}
+	case "Status":
+		if f.Op != OpEq {
+			return fmt.Sprintf("Invalid operator %v for Status", f.Op), true
+		}
+		if !slices.Contains(workflow.queryValues(), f.Value) {
+			return "Invalid Status query value", false
+		}
+	case "Description":
+		switch f.Op {
+		case OpEq, OpContains, OpPrefix, OpEqualFold:
+		case OpRegex:
+			if _, err := compileRegex(f.Value); err != nil {
+				return fmt.Sprintf("Invalid regular expression %v", err), false
+			}
+		default:
+			return fmt.Sprintf("Invalid operator %v for Description", f.Op), true
+		}
+	case "CreatedAt", "UpdatedAt":
+		switch f.Op {
+		case OpEq, OpLt, OpLte, OpGt, OpGte:
+		case OpBetween:
+			if !strings.Contains(f.Value, "..") {
+				return fmt.Sprintf("Invalid range %q, expected from..to", f.Value), false
+			}
+		default:
+			return fmt.Sprintf("Invalid operator %v for %v", f.Op, f.Field), true
+		}
+		// Values are valid or not whatever the time and location.
+		if _, ok := filterSpan(f.Op, f.Value, dateContext{now: time.Now(), loc: time.UTC}); !ok {
+			return fmt.Sprintf("Invalid time %q, expected a date, an RFC 3339 timestamp, now, today, yesterday, tomorrow or an offset such as -7d", f.Value), false
+		}
+	default:
+		return fmt.Sprintf("Invalid query field. Got %v", f.Field), true
+	}
+
+	return "", false
+}
+
+// sortKey is a field to sort by and its direction.
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// sortKeys returns the keys of the SortBy and Sort of a validated query.
+func (q *Query) sortKeys() []sortKey {
+	if q.SortBy == "" {
+		return nil
+	}
+
+	fields := strings.Split(q.SortBy, ",")
+	directions := strings.Split(q.Sort, ",")
+
+	keys := make([]sortKey, len(fields))
+	for i, field := range fields {
+		direction := directions[0]
+		if len(directions) == len(fields) {
+			direction = directions[i]
+		}
+		keys[i] = sortKey{field: field, desc: direction == "desc"}
+	}
+
+	return keys
+}
+
+// sortFields are the fields a query can sort by.
+var sortFields = []string{"Id", "Status", "CreatedAt", "UpdatedAt", "Description"}
+
+// checkSort checks the SortBy and Sort of a query.
+func checkSort(sortBy string, hasSortBy bool, sort string, hasSort bool) error {
+	fields := strings.Split(sortBy, ",")
+	directions := strings.Split(sort, ",")
+
+	if hasSort && slices.ContainsFunc(directions, func(d string) bool { return d != "asc" && d != "desc" }) {
+		return &InvalidQueryError{Key: "Sort", Message: "Invalid Sort query value"}
+	}
+
+	if hasSortBy {
+		for i, field := range fields {
+			if !slices.Contains(sortFields, field) {
+				return &InvalidQueryError{Key: "SortBy", Message: "Invalid sort, sort by only accepts Id, Status, CreatedAt, UpdatedAt, Description"}
+			}
+			if slices.Contains(fields[:i], field) {
+				return &InvalidQueryError{Key: "SortBy", Message: fmt.Sprintf("Invalid sort, %v is sorted by twice", field)}
+			}
+		}
+	}
+
+	if hasSort && hasSortBy && len(directions) != 1 && len(directions) != len(fields) {
+		return &InvalidQueryError{Key: "Sort", Message: fmt.Sprintf("Sort has %d directions for %d SortBy fields, expected one or one per field", len(directions), len(fields))}
+	}
+
+	if hasSort && !hasSortBy {
+		return &InvalidQueryError{Key: "Sort", Message: "If the query has a sort, then the field must be defined by SortBy"}
+	}
+
+	if hasSortBy && !hasSort {
+		return &InvalidQueryError{Key: "SortBy", Message: "If the query has a sort by a field, then the direction must be defined by Sort"}
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// fuzzyMinScore is the lowest score FuzzySearch returns.
+	fuzzyMinScore = 0.6
+	// fuzzyPrefixWeight scales a word matched by its beginning only, as
+	// while the user is still typing it.
+	fuzzyPrefixWeight = 0.9
+	// resolveMargin is how far the best fuzzy match of ResolveId must be
+	// ahead of the next one to be picked.
+	resolveMargin = 0.1
+)
+
+// FuzzyMatch is a todo found by FuzzySearch. Score is between
+// fuzzyMinScore and 1, where 1 means every query word was found as is.
+type FuzzyMatch struct {
+	TodoEntity
+	Score float64
+}
+
+// FuzzySearch ranks the todos of ops whose Description resembles query,
+// tolerating typos such as "deply staging" for "Deploy staging cluster".
+// Every query word is scored against its closest Description word by edit
+// distance, also against the beginning of longer words so partially typed
+// words match. It returns the best limit matches, best first; a limit of 0
+// or less returns every match.
+func FuzzySearch(ctx context.Context, ops TodoOperations, query string, limit int) ([]FuzzyMatch, error) {
+	words := fuzzyWords(query)
+
+	matches := make([]FuzzyMatch, 0)
+	if len(words) == 0 {
+		return matches, nil
+	}
+
+	matcher := newFuzzyMatcher(words)
+	for entity, err := range ops.IterAll(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if score := matcher.score(fuzzyWords(entity.Description)); score >= fuzzyMinScore {
+			matches = append(matches, FuzzyMatch{TodoEntity: entity, Score: score})
+		}
+	}
+
+	// Among equal scores the shorter description is the closer one.
+	slices.SortStableFunc(matches, func(m1 FuzzyMatch, m2 FuzzyMatch) int {
+		if c := cmp.Compare(m2.Score, m1.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(len(m1.Description), len(m2.Description))
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, nil
+}
+
+// ResolveId turns what a user typed where a todo Id is expected into an
+// Id of ops: the Id itself, the only Id starting with ref, or the todo
+// whose Description fuzzy matches ref clearly better than any other. It
+// fails with a *NotFoundError when nothing matches and an
+// *AmbiguousIdError when several todos match about as well.
+func ResolveId(ctx context.Context, ops TodoOperations, ref string) (string, error) {
+	if ref == "" {
+		return "", &NotFoundError{Id: ref}
+	}
+
+	var prefixed []string
+	for entity, err := range ops.IterAll(ctx) {
+		if err != nil {
+			return "", err
+		}
+		if entity.Id == ref {
+			return ref, nil
+		}
+		if strings.HasPrefix(entity.Id, ref) {
+			prefixed = append(prefixed, entity.Id)
+		}
+	}
+
+	switch {
+	case len(prefixed) == 1:
+		return prefixed[0], nil
+	case len(prefixed) > 1:
+		return "", &AmbiguousIdError{Ref: ref, Candidates: prefixed}
+	}
+
+	matches, err := FuzzySearch(ctx, ops, ref, 0)
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "", &NotFoundError{Id: ref}
+	}
+
+	candidates := []string{matches[0].Id}
+	for _, m := range matches[1:] {
+		if matches[0].Score-m.Score < resolveMargin {
+			candidates = append(candidates, m.Id)
+		}
+	}
+
+	if len(candidates) > 1 {
+		return "", &AmbiguousIdError{Ref: ref, Candidates: candidates}
+	}
+
+	return matches[0].Id, nil
+}
+
+// fuzzyWords splits text into lowercase words without diacritics.
+func fuzzyWords(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+
+	words := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if w := normalizeTerm(f); w != "" {
+			words = append(words, w)
+		}
+	}
+
+	return words
+}
+
+// fuzzyMatcher scores texts against the words of a query. Todos share most
+// of their words, so it remembers the similarities of every text word it
+// has seen. It must not be shared by goroutines.
+type fuzzyMatcher struct {
+	query [][]rune
+	seen  map[string][]float64
+	rows  [3][]int
+}
+
+func newFuzzyMatcher(query []string) *fuzzyMatcher {
+	m := &fuzzyMatcher{query: make([][]rune, len(query)), seen: make(map[string][]float64)}
+	for i, q := range query {
+		m.query[i] = []rune(q)
+	}
+
+	return m
+}
+
+// score averages, over the query words, the similarity of each one to its
+// closest word of text.
+func (m *fuzzyMatcher) score(text []string) float64 {
+	if len(text) == 0 || len(m.query) == 0 {
+		return 0
+	}
+
+	best := make([]float64, len(m.query))
+	for _, w := range text {
+		similarities, ok := m.seen[w]
+		if !ok {
+			wr := []rune(w)
+			similarities = make([]float64, len(m.query))
+			for i, q := range m.query {
+				similarities[i] = m.similarity(q, wr)
+			}
+			m.seen[w] = similarities
+		}
+		for i, s := range similarities {
+			best[i] = max(best[i], s)
+		}
+	}
+
+	total := 0.0
+	for _, s := range best {
+		total += s
+	}
+
+	return total / float64(len(m.query))
+}
+
+// similarity is 1 minus the edit distance of q and w relative to the longer
+// one. A q shorter than w is also compared with as many runes of w.
+func (m *fuzzyMatcher) similarity(q []rune, w []rune) float64 {
+	similarity := 1 - float64(m.editDistance(q, w))/float64(max(len(q), len(w)))
+
+	if len(w) > len(q) && similarity < fuzzyPrefixWeight {
+		prefix := 1 - float64(m.editDistance(q, w[:len(q)]))/float64(len(q))
+		similarity = max(similarity, prefix*fuzzyPrefixWeight)
+	}
+
+	return similarity
+}
+
+func (m *fuzzyMatcher) editDistance(a []rune, b []rune) int {
+	for i := range m.rows {
+		if cap(m.rows[i]) < len(b)+1 {
+			m.rows[i] = make([]int, len(b)+1)
+		}
+	}
+
+	return editDistance(a, b, m.rows[0][:len(b)+1], m.rows[1][:len(b)+1], m.rows[2][:len(b)+1])
+}
+
+// editDistance is the optimal string alignment distance of a and b: the
+// insertions, deletions, substitutions and swaps of adjacent runes that turn
+// a into b. prev2, prev and cur are scratch rows of len(b)+1.
+func editDistance(a []rune, b []rune, prev2 []int, prev []int, cur []int) int {
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(b)]
+}
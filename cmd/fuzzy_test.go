@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "abc", want: 3},
+		{a: "deply", b: "deploy", want: 1},
+		{a: "stagnig", b: "staging", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "café", b: "cafe", want: 1},
+	}
+
+	for _, tc := range tests {
+		if got := new(fuzzyMatcher).editDistance([]rune(tc.a), []rune(tc.b)); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	repository := newSearchRepository(t,
+		"Deploy staging cluster",
+		"Deploy production cluster",
+		"Buy milk",
+		"Stage the release notes",
+		"Résumé review",
+	)
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{query: "deply", want: []string{"1", "2"}},
+		{query: "deply staging", want: []string{"1"}},
+		{query: "deply stagnig", limit: 1, want: []string{"1"}},
+		{query: "by mlk", want: []string{"3"}},
+		{query: "resume", want: []string{"5"}},
+		{query: "prod", want: []string{"2"}},
+		{query: "zzzz", want: []string{}},
+		{query: "  ", want: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			matches, err := FuzzySearch(context.Background(), repository, tc.query, tc.limit)
+			if err != nil {
+				t.Fatalf("FuzzySearch() error %v", err)
+			}
+
+			got := make([]string, 0, len(matches))
+			for _, m := range matches {
+				got = append(got, m.Id)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FuzzySearch() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveId(t *testing.T) {
+	ids := []string{"7f3a9c", "7f3b12", "c04e5d", "9", "91"}
+	repository := &TodoRepository{
+		GenerateId: func() string {
+			id := ids[0]
+			ids = ids[1:]
+			return id
+		},
+		Clock:    fixedClock,
+		TodoList: make([]TodoEntity, 0),
+	}
+	for _, d := range []string{"Deploy staging cluster", "Deploy production cluster", "Buy milk", "Call mom", "Call dad"} {
+		if _, err := repository.Insert(&Todo{Description: d}); err != nil {
+			t.Fatalf("Insert() error %v", err)
+		}
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "7f3a9c", want: "7f3a9c"},
+		{ref: "9", want: "9"},
+		{ref: "c0", want: "c04e5d"},
+		{ref: "7f3a", want: "7f3a9c"},
+		{ref: "7f3", wantErr: ErrAmbiguous},
+		{ref: "deply stagnig", want: "7f3a9c"},
+		{ref: "by milk", want: "c04e5d"},
+		{ref: "deploy cluster", wantErr: ErrAmbiguous},
+		{ref: "kubernetes", wantErr: ErrNotFound},
+		{ref: "", wantErr: ErrNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			got, err := ResolveId(context.Background(), repository, tc.ref)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ResolveId() error %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ResolveId() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	var ambiguous *AmbiguousIdError
+	_, err := ResolveId(context.Background(), repository, "call")
+	if !errors.As(err, &ambiguous) || !reflect.DeepEqual(ambiguous.Candidates, []string{"9", "91"}) {
+		t.Errorf("ResolveId() error %v, want an *AmbiguousIdError for ids 9 and 91", err)
+	}
+}
+
+func BenchmarkFuzzySearch(b *testing.B) {
+	descriptions := make([]string, 10_000)
+	for i := range descriptions {
+		descriptions[i] = "Deploy service " + strconv.Itoa(i) + " to the staging cluster and verify dashboards"
+	}
+	repository := newSearchRepository(b, descriptions...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := FuzzySearch(context.Background(), repository, "deply stagnig dashbord", 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
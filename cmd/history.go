@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"slices"
+	"time"
+)
+
+// Completion returns when the todo was completed, or false if it is not.
+// A todo stored before completions were recorded has no History; if it is
+// in a Completed state of workflow, nil meaning DefaultWorkflow, its last
+// update stands for its completion.
+func (e *TodoEntity) Completion(workflow *Workflow) (time.Time, bool) {
+	if !e.CompletedAt.IsZero() {
+		return e.CompletedAt, true
+	}
+
+	if e.History == nil && slices.Contains(workflow.orDefault().Completed, e.Status) {
+		return e.UpdatedAt, true
+	}
+
+	return time.Time{}, false
+}
+
+// LeadTime returns the time from the creation of a completed todo to its
+// completion, or false if the todo is not completed. The workflow is the
+// one of Completion.
+func (e *TodoEntity) LeadTime(workflow *Workflow) (time.Duration, bool) {
+	completed, ok := e.Completion(workflow)
+	if !ok {
+		return 0, false
+	}
+
+	return completed.Sub(e.CreatedAt), true
+}
+
+// CycleTime returns the time from the first change of status of a completed
+// todo, when work on it started, to its completion. It is 0 for a todo
+// inserted completed, and false for a todo that is not completed or has no
+// History. The History of a todo stored before it was recorded starts with
+// a change of status rather than the insert.
+func (e *TodoEntity) CycleTime() (time.Duration, bool) {
+	if len(e.History) == 0 || e.CompletedAt.IsZero() {
+		return 0, false
+	}
+
+	first := 0
+	if e.History[0].From == "" && len(e.History) > 1 {
+		first = 1
+	}
+	started := e.History[first].At
+
+	return e.CompletedAt.Sub(started), true
+}
+
+// TimeInStatus returns how long the todo has spent in each status according
+// to its History, counting the current status until now.
+func (e *TodoEntity) TimeInStatus(now time.Time) map[TodoStatus]time.Duration {
+	result := make(map[TodoStatus]time.Duration)
+	for i, change := range e.History {
+		until := now
+		if i+1 < len(e.History) {
+			until = e.History[i+1].At
+		}
+		result[change.To] += until.Sub(change.At)
+	}
+
+	return result
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTodoEntityTimes(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, 11, 10, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name         string
+		entity       TodoEntity
+		workflow     *Workflow
+		wantLead     time.Duration
+		wantLeadOk   bool
+		wantCycle    time.Duration
+		wantCycleOk  bool
+		wantInStatus map[TodoStatus]time.Duration
+	}{
+		{
+			name: "Completed after review",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(1), UpdatedAt: at(9), CompletedAt: at(9), History: []StatusChange{
+					{To: StatusNotDone, At: at(1)},
+					{From: StatusNotDone, To: StatusInProgress, At: at(3)},
+					{From: StatusInProgress, To: StatusInReview, At: at(7)},
+					{From: StatusInReview, To: StatusDone, At: at(9)},
+				}},
+				Todo: Todo{Status: StatusDone},
+			},
+			wantLead: 8 * time.Hour, wantLeadOk: true,
+			wantCycle: 6 * time.Hour, wantCycleOk: true,
+			wantInStatus: map[TodoStatus]time.Duration{StatusNotDone: 2 * time.Hour, StatusInProgress: 4 * time.Hour, StatusInReview: 2 * time.Hour, StatusDone: 3 * time.Hour},
+		},
+		{
+			name: "Reopened",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(1), UpdatedAt: at(5), History: []StatusChange{
+					{To: StatusNotDone, At: at(1)},
+					{From: StatusNotDone, To: StatusDone, At: at(2)},
+					{From: StatusDone, To: StatusNotDone, At: at(5)},
+				}},
+				Todo: Todo{Status: StatusNotDone},
+			},
+			wantInStatus: map[TodoStatus]time.Duration{StatusNotDone: 8 * time.Hour, StatusDone: 3 * time.Hour},
+		},
+		{
+			name: "Inserted completed",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(4), UpdatedAt: at(4), CompletedAt: at(4), History: []StatusChange{{To: StatusDone, At: at(4)}}},
+				Todo:   Todo{Status: StatusDone},
+			},
+			wantLeadOk: true, wantCycleOk: true,
+			wantInStatus: map[TodoStatus]time.Duration{StatusDone: 8 * time.Hour},
+		},
+		{
+			name: "Completed after being stored without History",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(1), UpdatedAt: at(9), CompletedAt: at(9), History: []StatusChange{
+					{From: StatusNotDone, To: StatusInProgress, At: at(5)},
+					{From: StatusInProgress, To: StatusDone, At: at(9)},
+				}},
+				Todo: Todo{Status: StatusDone},
+			},
+			wantLead: 8 * time.Hour, wantLeadOk: true,
+			wantCycle: 4 * time.Hour, wantCycleOk: true,
+			wantInStatus: map[TodoStatus]time.Duration{StatusInProgress: 4 * time.Hour, StatusDone: 3 * time.Hour},
+		},
+		{
+			name: "Done before completions were recorded",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(1), UpdatedAt: at(6)},
+				Todo:   Todo{Status: StatusDone},
+			},
+			wantLead: 5 * time.Hour, wantLeadOk: true,
+			wantInStatus: map[TodoStatus]time.Duration{},
+		},
+		{
+			name: "Shipped before completions were recorded",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(1), UpdatedAt: at(4)},
+				Todo:   Todo{Status: "Shipped"},
+			},
+			workflow: &Workflow{States: []TodoStatus{"Todo", "Shipped"}, Completed: []TodoStatus{"Shipped"}},
+			wantLead: 3 * time.Hour, wantLeadOk: true,
+			wantInStatus: map[TodoStatus]time.Duration{},
+		},
+		{
+			name: "Done before completions were recorded in a workflow without Done",
+			entity: TodoEntity{
+				Entity: Entity{CreatedAt: at(1), UpdatedAt: at(4)},
+				Todo:   Todo{Status: StatusDone},
+			},
+			workflow:     &Workflow{States: []TodoStatus{"Todo", "Shipped"}, Completed: []TodoStatus{"Shipped"}},
+			wantInStatus: map[TodoStatus]time.Duration{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if lead, ok := tc.entity.LeadTime(tc.workflow); lead != tc.wantLead || ok != tc.wantLeadOk {
+				t.Errorf("LeadTime() = %v, %v, want %v, %v", lead, ok, tc.wantLead, tc.wantLeadOk)
+			}
+			if cycle, ok := tc.entity.CycleTime(); cycle != tc.wantCycle || ok != tc.wantCycleOk {
+				t.Errorf("CycleTime() = %v, %v, want %v, %v", cycle, ok, tc.wantCycle, tc.wantCycleOk)
+			}
+			if got := tc.entity.TimeInStatus(at(12)); !reflect.DeepEqual(got, tc.wantInStatus) {
+				t.Errorf("TimeInStatus() = %v, want %v", got, tc.wantInStatus)
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsLegacyCompletion(t *testing.T) {
+	created := time.Date(2024, 11, 10, 9, 0, 0, 0, time.UTC)
+	legacy := TodoEntity{
+		Entity: Entity{Id: "1", CreatedAt: created, UpdatedAt: created.Add(30 * time.Minute), Version: 1},
+		Todo:   Todo{Description: "Ship", Status: StatusDone},
+	}
+	repository := &TodoRepository{
+		Clock:    func() time.Time { return created.Add(time.Hour) },
+		TodoList: []TodoEntity{legacy},
+	}
+
+	edited, err := repository.Update("1", Todo{Description: "Ship it"})
+	if err != nil {
+		t.Fatalf("Update() error %v", err)
+	}
+	if !edited.CompletedAt.Equal(legacy.UpdatedAt) || edited.History != nil {
+		t.Errorf("Update() = completed at %v with history %v, want completed at %v without history", edited.CompletedAt, edited.History, legacy.UpdatedAt)
+	}
+	if lead, ok := edited.LeadTime(nil); lead != 30*time.Minute || !ok {
+		t.Errorf("LeadTime() after an edit = %v, %v, want 30m, true", lead, ok)
+	}
+
+	reopened, err := repository.Update("1", Todo{Status: StatusNotDone})
+	if err != nil {
+		t.Fatalf("Update() error %v", err)
+	}
+	if _, ok := reopened.Completion(nil); ok {
+		t.Errorf("Completion() after reopening = %v, want none", reopened.CompletedAt)
+	}
+}
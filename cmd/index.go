@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"time"
+)
+
+// todoIndex holds lookups over the todos of a TodoList. Every todo gets a
+// sequence number when it is indexed, ascending with its position, and the
+// lookups hold sequence numbers rather than positions so that a delete does
+// not renumber them. byId maps an id to its sequence numbers, byStatus keeps
+// those of every status in ascending order and createdAt and updatedAt keep
+// all of them ordered by that timestamp, ties broken by sequence number.
+type todoIndex struct {
+	// list is the TodoList the positions refer to.
+	list []TodoEntity
+	// seqs holds the sequence number of every position of list.
+	seqs []int
+	// next is the sequence number of the next inserted todo.
+	next      int
+	byId      map[string][]int
+	byStatus  map[TodoStatus][]int
+	createdAt []int
+	updatedAt []int
+	// text is the full-text index, built by the first search.
+	text *textIndex
+}
+
+func createdAtOf(e *TodoEntity) time.Time { return e.CreatedAt }
+
+func updatedAtOf(e *TodoEntity) time.Time { return e.UpdatedAt }
+
+func buildTodoIndex(list []TodoEntity) *todoIndex {
+	idx := &todoIndex{
+		list:      list,
+		seqs:      make([]int, len(list)),
+		next:      len(list),
+		byId:      make(map[string][]int, len(list)),
+		byStatus:  make(map[TodoStatus][]int),
+		createdAt: make([]int, len(list)),
+		updatedAt: make([]int, len(list)),
+	}
+
+	// A built index numbers every todo with its position.
+	for p := range list {
+		idx.seqs[p] = p
+		idx.byId[list[p].Id] = append(idx.byId[list[p].Id], p)
+		idx.byStatus[list[p].Status] = append(idx.byStatus[list[p].Status], p)
+		idx.createdAt[p] = p
+		idx.updatedAt[p] = p
+	}
+
+	idx.sortByTime(idx.createdAt, createdAtOf)
+	idx.sortByTime(idx.updatedAt, updatedAtOf)
+
+	return idx
+}
+
+// sortByTime sorts the sequence numbers of a built index, which are still
+// positions, by timestamp.
+func (idx *todoIndex) sortByTime(seqs []int, at func(*TodoEntity) time.Time) {
+	slices.SortFunc(seqs, func(p1 int, p2 int) int {
+		if c := at(&idx.list[p1]).Compare(at(&idx.list[p2])); c != 0 {
+			return c
+		}
+		return cmp.Compare(p1, p2)
+	})
+}
+
+// covers reports whether the index was built for list. It only notices a
+// TodoList that was replaced, not one changed in place.
+func (idx *todoIndex) covers(list []TodoEntity) bool {
+	if len(idx.list) != len(list) {
+		return false
+	}
+
+	return len(list) == 0 || &idx.list[0] == &list[0]
+}
+
+// position returns the position of the todo with the sequence number seq,
+// or -1.
+func (idx *todoIndex) position(seq int) int {
+	if p, found := slices.BinarySearch(idx.seqs, seq); found {
+		return p
+	}
+
+	return -1
+}
+
+// positions returns the positions of the ascending sequence numbers seqs,
+// which must all be indexed.
+func (idx *todoIndex) positions(seqs []int) []int {
+	// Until a todo is deleted, sequence numbers are positions.
+	if n := len(idx.seqs); n == 0 || idx.seqs[n-1] == n-1 {
+		return seqs
+	}
+
+	positions := make([]int, len(seqs))
+	p := 0
+	for i, seq := range seqs {
+		j, _ := slices.BinarySearch(idx.seqs[p:], seq)
+		p += j
+		positions[i] = p
+	}
+
+	return positions
+}
+
+func (idx *todoIndex) entity(seq int) *TodoEntity {
+	return &idx.list[idx.position(seq)]
+}
+
+// first returns the lowest position of the todo with id, or -1.
+func (idx *todoIndex) first(id string) int {
+	if seqs := idx.byId[id]; len(seqs) > 0 {
+		return idx.position(seqs[0])
+	}
+
+	return -1
+}
+
+// apply applies the mutations to the indexed list like applyMutations and
+// keeps the index in step with it.
+func (idx *todoIndex) apply(mutations []Mutation) []TodoEntity {
+	for _, m := range mutations {
+		if m.Op == MutationInsert {
+			seq := idx.next
+			idx.next++
+			idx.list = append(idx.list, m.Entity)
+			idx.seqs = append(idx.seqs, seq)
+			idx.byId[m.Entity.Id] = append(idx.byId[m.Entity.Id], seq)
+			idx.byStatus[m.Entity.Status] = append(idx.byStatus[m.Entity.Status], seq)
+			idx.createdAt = idx.insertByTime(idx.createdAt, createdAtOf, seq)
+			idx.updatedAt = idx.insertByTime(idx.updatedAt, updatedAtOf, seq)
+			if idx.text != nil {
+				idx.text.insert(seq, &m.Entity)
+			}
+			continue
+		}
+
+		seqs := idx.byId[m.Entity.Id]
+		if len(seqs) == 0 {
+			continue
+		}
+		seq := seqs[0]
+		p := idx.position(seq)
+		old := idx.list[p]
+
+		switch m.Op {
+		case MutationUpdate:
+			// Sequence numbers leave the orderings while their position
+			// still holds the old entity, so the searches find them.
+			statusChanged := old.Status != m.Entity.Status
+			createdChanged := !old.CreatedAt.Equal(m.Entity.CreatedAt)
+			updatedChanged := !old.UpdatedAt.Equal(m.Entity.UpdatedAt)
+
+			if statusChanged {
+				idx.byStatus[old.Status] = removeSorted(idx.byStatus[old.Status], seq)
+			}
+			if createdChanged {
+				idx.createdAt = idx.removeByTime(idx.createdAt, createdAtOf, seq)
+			}
+			if updatedChanged {
+				idx.updatedAt = idx.removeByTime(idx.updatedAt, updatedAtOf, seq)
+			}
+
+			idx.list[p] = m.Entity
+
+			if statusChanged {
+				idx.byStatus[m.Entity.Status] = insertSorted(idx.byStatus[m.Entity.Status], seq)
+			}
+			if createdChanged {
+				idx.createdAt = idx.insertByTime(idx.createdAt, createdAtOf, seq)
+			}
+			if updatedChanged {
+				idx.updatedAt = idx.insertByTime(idx.updatedAt, updatedAtOf, seq)
+			}
+			if idx.text != nil {
+				idx.text.update(seq, &old, &m.Entity)
+			}
+		case MutationDelete:
+			idx.byId[old.Id] = removeSorted(seqs, seq)
+			if len(idx.byId[old.Id]) == 0 {
+				delete(idx.byId, old.Id)
+			}
+			idx.byStatus[old.Status] = removeSorted(idx.byStatus[old.Status], seq)
+			idx.createdAt = idx.removeByTime(idx.createdAt, createdAtOf, seq)
+			idx.updatedAt = idx.removeByTime(idx.updatedAt, updatedAtOf, seq)
+			if idx.text != nil {
+				idx.text.delete(seq, &old)
+			}
+
+			// The other todos keep their sequence numbers.
+			idx.list = slices.Delete(idx.list, p, p+1)
+			idx.seqs = slices.Delete(idx.seqs, p, p+1)
+		}
+	}
+
+	return idx.list
+}
+
+func insertSorted(seqs []int, seq int) []int {
+	i, _ := slices.BinarySearch(seqs, seq)
+	return slices.Insert(seqs, i, seq)
+}
+
+func removeSorted(seqs []int, seq int) []int {
+	if i, found := slices.BinarySearch(seqs, seq); found {
+		return slices.Delete(seqs, i, i+1)
+	}
+
+	return seqs
+}
+
+func (idx *todoIndex) searchByTime(seqs []int, at func(*TodoEntity) time.Time, seq int) (int, bool) {
+	t := at(idx.entity(seq))
+	return slices.BinarySearchFunc(seqs, seq, func(s int, seq int) int {
+		if c := at(idx.entity(s)).Compare(t); c != 0 {
+			return c
+		}
+		return cmp.Compare(s, seq)
+	})
+}
+
+func (idx *todoIndex) insertByTime(seqs []int, at func(*TodoEntity) time.Time, seq int) []int {
+	i, _ := idx.searchByTime(seqs, at, seq)
+	return slices.Insert(seqs, i, seq)
+}
+
+func (idx *todoIndex) removeByTime(seqs []int, at func(*TodoEntity) time.Time, seq int) []int {
+	if i, found := idx.searchByTime(seqs, at, seq); found {
+		return slices.Delete(seqs, i, i+1)
+	}
+
+	return seqs
+}
+
+// candidates are the sequence numbers of the todos that can match a
+// filter. ordered tells whether they are in ascending order, which a range
+// of a timestamp ordering is not.
+type candidates struct {
+	seqs    []int
+	ordered bool
+}
+
+// plan picks the most selective index for a validated filter. It returns
+// the positions of the todos that can match, in ascending order, or false
+// if no index applies and the whole list has to be scanned. The candidates
+// still have to be checked with matchFilter.
+func (idx *todoIndex) plan(filter Filter, dc dateContext) ([]int, bool) {
+	c, ok := idx.candidates(filter, dc)
+	if !ok {
+		return nil, false
+	}
+
+	if !c.ordered {
+		c.seqs = slices.Clone(c.seqs)
+		slices.Sort(c.seqs)
+	}
+
+	return idx.positions(c.seqs), true
+}
+
+func (idx *todoIndex) candidates(filter Filter, dc dateContext) (candidates, bool) {
+	switch f := filter.(type) {
+	case FieldFilter:
+		switch f.Field {
+		case "Id":
+			if f.Op == OpEq {
+				return candidates{seqs: idx.byId[f.Value], ordered: true}, true
+			}
+		case "Status":
+			if f.Op == OpEq {
+				return candidates{seqs: idx.byStatus[TodoStatus(f.Value)], ordered: true}, true
+			}
+		case "CreatedAt", "UpdatedAt":
+			return idx.timeRange(f.Field, []FieldFilter{f}, dc), true
+		}
+	case AndFilter:
+		var best candidates
+		found := false
+		consider := func(c candidates) {
+			if !found || len(c.seqs) < len(best.seqs) {
+				best, found = c, true
+			}
+		}
+
+		// Comparisons of one timestamp narrow a single range together.
+		dates := make(map[string][]FieldFilter)
+		for _, child := range f.Filters {
+			if ff, ok := child.(FieldFilter); ok && (ff.Field == "CreatedAt" || ff.Field == "UpdatedAt") {
+				dates[ff.Field] = append(dates[ff.Field], ff)
+			} else if c, ok := idx.candidates(child, dc); ok {
+				consider(c)
+			}
+		}
+		for field, filters := range dates {
+			consider(idx.timeRange(field, filters, dc))
+		}
+
+		return best, found
+	case OrFilter:
+		var union []int
+		for _, child := range f.Filters {
+			c, ok := idx.candidates(child, dc)
+			if !ok {
+				return candidates{}, false
+			}
+			union = append(union, c.seqs...)
+		}
+		slices.Sort(union)
+
+		return candidates{seqs: slices.Compact(union), ordered: true}, true
+	}
+
+	return candidates{}, false
+}
+
+// indexable reports whether plan has an index for filter.
+func indexable(filter Filter) bool {
+	switch f := filter.(type) {
+	case FieldFilter:
+		switch f.Field {
+		case "Id", "Status":
+			return f.Op == OpEq
+		case "CreatedAt", "UpdatedAt":
+			return true
+		}
+	case AndFilter:
+		return slices.ContainsFunc(f.Filters, indexable)
+	case OrFilter:
+		for _, child := range f.Filters {
+			if !indexable(child) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// timeRange returns the sequence numbers of the field's ordering whose
+// timestamp falls inside the span all of filters allow, matching matchField.
+func (idx *todoIndex) timeRange(field string, filters []FieldFilter, dc dateContext) candidates {
+	seqs, at := idx.createdAt, createdAtOf
+	if field == "UpdatedAt" {
+		seqs, at = idx.updatedAt, updatedAtOf
+	}
+
+	var span timeSpan
+	for _, f := range filters {
+		fs, _ := filterSpan(f.Op, f.Value, dc)
+		span = span.intersect(fs)
+	}
+
+	lo, hi := 0, len(seqs)
+	if span.hasFrom {
+		lo = sort.Search(len(seqs), func(i int) bool {
+			return !at(idx.entity(seqs[i])).Before(span.from)
+		})
+	}
+	if span.hasTo {
+		hi = sort.Search(len(seqs), func(i int) bool {
+			return !at(idx.entity(seqs[i])).Before(span.to)
+		})
+	}
+
+	return candidates{seqs: seqs[lo:max(lo, hi)]}
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// indexedTodos builds n todos spread over a year, alternating status.
+func indexedTodos(n int) []TodoEntity {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	todos := make([]TodoEntity, n)
+	for i := range todos {
+		created := start.Add(time.Duration(i%365)*24*time.Hour + time.Duration(i%24)*time.Hour)
+		status := StatusNotDone
+		if i%2 == 0 {
+			status = StatusDone
+		}
+		todos[i] = TodoEntity{
+			Entity: Entity{Id: strconv.Itoa(i), CreatedAt: created, UpdatedAt: created.Add(time.Duration(i%48) * time.Hour), Version: 1},
+			Todo:   Todo{Description: "Todo " + strconv.Itoa(i), Status: status},
+		}
+	}
+
+	return todos
+}
+
+// scanQuery is the linear scan the index replaces.
+func scanQuery(todoList []TodoEntity, query map[string]string) []TodoEntity {
+	result := make([]TodoEntity, 0)
+	for i := range todoList {
+		if matchQuery(&todoList[i], query, dateContext{loc: time.UTC}) {
+			result = append(result, todoList[i])
+		}
+	}
+
+	return result
+}
+
+var indexQueries = []map[string]string{
+	{"Id": "42"},
+	{"Id": "missing"},
+	{"Status": "Done"},
+	{"CreatedAt": "2024-03-01"},
+	{"CreatedAt_gt": "2024-12-01"},
+	{"CreatedAt_gt": "2024-02-01", "CreatedAt_lt": "2024-02-10", "Status": "NotDone"},
+	{"UpdatedAt_lt": "2024-01-05"},
+	{"UpdatedAt": "2024-06-01", "Description": "Todo 152"},
+}
+
+var indexFilters = []Filter{
+	Or(Eq("Id", "42"), Eq("Id", "7"), Eq("CreatedAt", "2024-05-05")),
+	And(Gt("CreatedAt", "2024-02-01"), Lt("CreatedAt", "2024-02-10"), Not(Eq("Status", "Done"))),
+	And(Contains("Description", "1"), Or(Lt("UpdatedAt", "2024-01-03"), Eq("Status", "Done"))),
+	Or(Eq("Status", "Done"), Contains("Description", "7")),
+}
+
+func TestIndexMatchesScan(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	repository := &TodoRepository{
+		GenerateId: sequenceId(),
+		Clock:      func() time.Time { return now },
+		TodoList:   indexedTodos(2000),
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		for _, query := range indexQueries {
+			got, err := repository.FetchByQuery(query)
+			if err != nil {
+				t.Fatalf("%v: FetchByQuery(%v) error %v", stage, query, err)
+			}
+			if want := scanQuery(repository.TodoList, query); !reflect.DeepEqual(got, want) {
+				t.Errorf("%v: FetchByQuery(%v) = %d todos, want %d", stage, query, len(got), len(want))
+			}
+		}
+		for _, filter := range indexFilters {
+			got, err := repository.FetchByFilter(Query{Filter: filter})
+			if err != nil {
+				t.Fatalf("%v: FetchByFilter(%v) error %v", stage, filter, err)
+			}
+			want := make([]TodoEntity, 0)
+			for i := range repository.TodoList {
+				if matchFilter(&repository.TodoList[i], filter, dateContext{loc: time.UTC}) {
+					want = append(want, repository.TodoList[i])
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%v: FetchByFilter(%v) = %d todos, want %d", stage, filter, len(got), len(want))
+			}
+		}
+	}
+
+	check("built")
+
+	for i := 0; i < 2000; i += 7 {
+		if _, err := repository.Update(strconv.Itoa(i), Todo{Status: StatusNotDone}); err != nil {
+			t.Fatalf("Update() error %v", err)
+		}
+	}
+	for i := 3; i < 2000; i += 11 {
+		if _, err := repository.Delete(strconv.Itoa(i)); err != nil {
+			t.Fatalf("Delete() error %v", err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := repository.Insert(&Todo{Description: "New"}); err != nil {
+			t.Fatalf("Insert() error %v", err)
+		}
+	}
+
+	check("maintained")
+
+	if !reflect.DeepEqual(renumbered(repository.idx), buildTodoIndex(repository.TodoList)) {
+		t.Errorf("maintained index differs from a rebuilt one")
+	}
+
+	// A replaced TodoList is indexed again.
+	repository.TodoList = indexedTodos(10)
+	check("replaced")
+}
+
+// renumbered returns a copy of idx with every sequence number replaced by
+// its position, as buildTodoIndex numbers them.
+func renumbered(idx *todoIndex) *todoIndex {
+	positions := func(seqs []int) []int {
+		result := make([]int, len(seqs))
+		for i, seq := range seqs {
+			result[i] = idx.position(seq)
+		}
+		return result
+	}
+
+	view := &todoIndex{
+		list:      idx.list,
+		seqs:      positions(idx.seqs),
+		next:      len(idx.list),
+		byId:      make(map[string][]int, len(idx.byId)),
+		byStatus:  make(map[TodoStatus][]int, len(idx.byStatus)),
+		createdAt: positions(idx.createdAt),
+		updatedAt: positions(idx.updatedAt),
+	}
+	for id, seqs := range idx.byId {
+		view.byId[id] = positions(seqs)
+	}
+	for status, seqs := range idx.byStatus {
+		view.byStatus[status] = positions(seqs)
+	}
+
+	if idx.text != nil {
+		view.text = &textIndex{postings: make(map[string][]posting), lengths: make(map[int]int), total: idx.text.total}
+		for term, postings := range idx.text.postings {
+			for _, p := range postings {
+				view.text.postings[term] = append(view.text.postings[term], posting{seq: idx.position(p.seq), freq: p.freq})
+			}
+		}
+		for seq, length := range idx.text.lengths {
+			view.text.lengths[idx.position(seq)] = length
+		}
+	}
+
+	return view
+}
+
+func BenchmarkFetchByQuery(b *testing.B) {
+	queries := []struct {
+		query map[string]string
+		name  string
+	}{
+		{name: "Id", query: map[string]string{"Id": "4242"}},
+		{name: "CreatedAt", query: map[string]string{"CreatedAt": "2024-03-01"}},
+		{name: "CreatedAtRangeAndStatus", query: map[string]string{"CreatedAt_gt": "2024-12-20", "Status": "Done"}},
+		{name: "Status", query: map[string]string{"Status": "Done"}},
+	}
+
+	for _, size := range []struct {
+		name string
+		n    int
+	}{{"100k", 100_000}, {"1M", 1_000_000}} {
+		repository := &TodoRepository{TodoList: indexedTodos(size.n)}
+		repository.index()
+
+		for _, q := range queries {
+			b.Run(size.name+"/"+q.name+"/scan", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					scanQuery(repository.TodoList, q.query)
+				}
+			})
+			b.Run(size.name+"/"+q.name+"/index", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := repository.FetchByQuery(q.query); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+
+		b.Run(size.name+"/Update", func(b *testing.B) {
+			repository.Clock = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+			for i := 0; i < b.N; i++ {
+				if _, err := repository.Update(strconv.Itoa(i%size.n), Todo{Description: "Updated"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		// Deletes run last, as they shrink the TodoList, and with the text
+		// index built so that it is maintained too.
+		b.Run(size.name+"/Delete/scan", func(b *testing.B) {
+			todoList := slices.Clone(repository.TodoList)
+			for i := 0; i < b.N; i++ {
+				m := Mutation{Op: MutationDelete, Entity: TodoEntity{Entity: Entity{Id: strconv.Itoa(i % size.n)}}}
+				todoList = applyMutations(todoList, []Mutation{m})
+			}
+		})
+		b.Run(size.name+"/Delete/index", func(b *testing.B) {
+			if _, err := repository.Search("todo", 1); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := repository.Delete(strconv.Itoa(i % size.n)); err != nil && !errors.Is(err, ErrNotFound) {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
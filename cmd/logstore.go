@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentPrefix  = "wal-"
+	segmentSuffix  = ".log"
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+
+	// recordHeaderSize is the length and CRC32 prefix of every log record.
+	recordHeaderSize = 8
+	maxRecordSize    = 64 << 20
+
+	DefaultSnapshotEvery = 1000
+)
+
+// snapshotDocument is the JSON layout of a snapshot. It holds the TodoList
+// with every record of the segments before Segment applied.
+type snapshotDocument struct {
+	Segment uint64
+	Todos   []TodoEntity
+}
+
+// LogStore is a TodoRepository backed by an append-only write-ahead log.
+// Every mutation is appended to the active segment; once SnapshotEvery
+// records have been written the TodoList is snapshotted and the older
+// segments are removed.
+type LogStore struct {
+	*TodoRepository
+	Dir           string
+	SnapshotEvery int
+
+	segment *os.File
+	seq     uint64
+	size    int64
+	records int
+}
+
+var _ TodoStore = (*LogStore)(nil)
+
+// OpenLogStore restores the TodoList from the newest snapshot in dir and
+// replays the log segments written after it. A torn record at the end of
+// the last segment, left by a crash during an append, is truncated away.
+func OpenLogStore(dir string, generateId GenerateId, clock Clock) (*LogStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	snapshots, segments, err := listLogFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	todoList := make([]TodoEntity, 0)
+	var seq uint64 = 1
+
+	if len(snapshots) > 0 {
+		snapshot, err := readSnapshot(filepath.Join(dir, snapshotName(snapshots[len(snapshots)-1])))
+		if err != nil {
+			return nil, err
+		}
+		todoList = snapshot.Todos
+		seq = snapshot.Segment
+	}
+
+	segments = slices.DeleteFunc(segments, func(s uint64) bool {
+		return s < seq
+	})
+
+	records := 0
+	var size int64
+	for i, s := range segments {
+		path := filepath.Join(dir, segmentName(s))
+		last := i == len(segments)-1
+
+		mutations, validSize, err := readSegment(path)
+		if errors.Is(err, errTornRecord) && last {
+			// Torn final record: drop it so new appends start clean.
+			err = os.Truncate(path, validSize)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Corrupted log segment %v: %w", path, err)
+		}
+
+		todoList = applyMutations(todoList, mutations)
+		records += len(mutations)
+		seq = s
+		size = validSize
+	}
+
+	segment, err := os.OpenFile(filepath.Join(dir, segmentName(seq)), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &LogStore{
+		TodoRepository: &TodoRepository{
+			GenerateId: generateId,
+			Clock:      clock,
+			TodoList:   todoList,
+		},
+		Dir:           dir,
+		SnapshotEvery: DefaultSnapshotEvery,
+		segment:       segment,
+		seq:           seq,
+		size:          size,
+		records:       records,
+	}
+	store.Journal = store.append
+
+	if err := store.compact(); err != nil {
+		segment.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close closes the active log segment.
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.segment.Close()
+}
+
+// Snapshot writes the current TodoList to a new snapshot, starts a new
+// segment and removes the segments and snapshots it supersedes.
+func (s *LogStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot()
+}
+
+// snapshot is Snapshot for callers already holding the write lock.
+func (s *LogStore) snapshot() error {
+	next := s.seq + 1
+
+	doc := snapshotDocument{Segment: next, Todos: s.TodoList}
+	if doc.Todos == nil {
+		doc.Todos = make([]TodoEntity, 0)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.Dir, snapshotName(next)), data); err != nil {
+		return err
+	}
+
+	segment, err := os.OpenFile(filepath.Join(s.Dir, segmentName(next)), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.segment.Close()
+	s.segment = segment
+	s.seq = next
+	s.size = 0
+	s.records = 0
+
+	return s.compact()
+}
+
+func (s *LogStore) append(mutations []Mutation) error {
+	// Snapshot before appending, while TodoList matches the log exactly.
+	if s.SnapshotEvery > 0 && s.records >= s.SnapshotEvery {
+		if err := s.snapshot(); err != nil {
+			return err
+		}
+	}
+
+	// The whole batch is one record, so a crash never applies part of it.
+	payload, err := json.Marshal(mutations)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+
+	if _, err := s.segment.Write(buf); err != nil {
+		// Best effort: drop a partially written batch.
+		s.segment.Truncate(s.size)
+		return err
+	}
+
+	if err := s.segment.Sync(); err != nil {
+		s.segment.Truncate(s.size)
+		return err
+	}
+
+	s.size += int64(len(buf))
+	s.records += len(mutations)
+
+	return nil
+}
+
+// compact removes the segments and snapshots older than the active segment.
+func (s *LogStore) compact() error {
+	snapshots, segments, err := listLogFiles(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range snapshots {
+		if seq < s.seq {
+			if err := os.Remove(filepath.Join(s.Dir, snapshotName(seq))); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Segments are only obsolete once a snapshot covers them.
+	if len(snapshots) == 0 || snapshots[len(snapshots)-1] != s.seq {
+		return nil
+	}
+
+	for _, seq := range segments {
+		if seq < s.seq {
+			if err := os.Remove(filepath.Join(s.Dir, segmentName(seq))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var errTornRecord = errors.New("torn log record")
+
+// readSegment decodes the record batches of a log segment. On a torn or corrupted
+// record it returns the records before it, the offset where it starts and
+// errTornRecord.
+func readSegment(path string) ([]Mutation, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mutations := make([]Mutation, 0)
+	var offset int64
+
+	for int(offset) < len(data) {
+		rest := data[offset:]
+		if len(rest) < recordHeaderSize {
+			return mutations, offset, fmt.Errorf("%w: truncated header", errTornRecord)
+		}
+
+		length := binary.BigEndian.Uint32(rest[0:4])
+		checksum := binary.BigEndian.Uint32(rest[4:8])
+
+		if length > maxRecordSize || int(length) > len(rest)-recordHeaderSize {
+			return mutations, offset, fmt.Errorf("%w: truncated payload", errTornRecord)
+		}
+
+		payload := rest[recordHeaderSize : recordHeaderSize+int(length)]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return mutations, offset, fmt.Errorf("%w: checksum mismatch", errTornRecord)
+		}
+
+		var batch []Mutation
+		if err := json.Unmarshal(payload, &batch); err != nil {
+			return mutations, offset, fmt.Errorf("%w: %w", errTornRecord, err)
+		}
+
+		mutations = append(mutations, batch...)
+		offset += recordHeaderSize + int64(length)
+	}
+
+	return mutations, offset, nil
+}
+
+func readSnapshot(path string) (*snapshotDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc snapshotDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Invalid snapshot %v: %w", path, err)
+	}
+
+	if doc.Todos == nil {
+		doc.Todos = make([]TodoEntity, 0)
+	}
+
+	return &doc, nil
+}
+
+// listLogFiles returns the sequence numbers of the snapshots and segments in
+// dir, in ascending order.
+func listLogFiles(dir string) ([]uint64, []uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshots, segments []uint64
+	for _, e := range entries {
+		if seq, ok := parseLogName(e.Name(), snapshotPrefix, snapshotSuffix); ok {
+			snapshots = append(snapshots, seq)
+		}
+		if seq, ok := parseLogName(e.Name(), segmentPrefix, segmentSuffix); ok {
+			segments = append(segments, seq)
+		}
+	}
+
+	slices.Sort(snapshots)
+	slices.Sort(segments)
+
+	return snapshots, segments, nil
+}
+
+func parseLogName(name string, prefix string, suffix string) (uint64, bool) {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return seq, true
+}
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%v%016d%v", segmentPrefix, seq, segmentSuffix)
+}
+
+func snapshotName(seq uint64) string {
+	return fmt.Sprintf("%v%016d%v", snapshotPrefix, seq, snapshotSuffix)
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func openTestLogStore(t *testing.T, dir string, generateId GenerateId) *LogStore {
+	store, err := OpenLogStore(dir, generateId, fixedClock)
+	if err != nil {
+		t.Fatalf("OpenLogStore() error %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	return store
+}
+
+func TestLogStoreConformance(t *testing.T) {
+	testTodoStore(t, func(t *testing.T, generateId GenerateId, clock Clock, seed []TodoEntity) TodoStore {
+		dir := t.TempDir()
+
+		data, err := json.Marshal(snapshotDocument{Segment: 1, Todos: append(make([]TodoEntity, 0), seed...)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, snapshotName(1)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := OpenLogStore(dir, generateId, clock)
+		if err != nil {
+			t.Fatalf("OpenLogStore() error %v", err)
+		}
+		t.Cleanup(func() {
+			store.Close()
+		})
+
+		return store
+	})
+}
+
+func TestLogStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	generateId := sequenceId()
+
+	store := openTestLogStore(t, dir, generateId)
+	for _, d := range []string{"First", "Second", "Third"} {
+		if _, err := store.Insert(&Todo{Description: d}); err != nil {
+			t.Fatalf("Insert() error %v", err)
+		}
+	}
+	if _, err := store.Update("2", Todo{Status: StatusDone}); err != nil {
+		t.Fatalf("Update() error %v", err)
+	}
+	if _, err := store.Delete("1"); err != nil {
+		t.Fatalf("Delete() error %v", err)
+	}
+
+	want, _ := store.FetchAll()
+	store.Close()
+
+	reopened := openTestLogStore(t, dir, generateId)
+	got, _ := reopened.FetchAll()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchAll() after replay = %v, want %v", got, want)
+	}
+}
+
+func TestLogStoreSnapshotCompaction(t *testing.T) {
+	dir := t.TempDir()
+	generateId := sequenceId()
+
+	store := openTestLogStore(t, dir, generateId)
+	store.SnapshotEvery = 2
+
+	for i := 0; i < 5; i++ {
+		if _, err := store.Insert(&Todo{Description: "Todo " + strconv.Itoa(i)}); err != nil {
+			t.Fatalf("Insert() error %v", err)
+		}
+	}
+
+	want, _ := store.FetchAll()
+	store.Close()
+
+	snapshots, segments, err := listLogFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || len(segments) != 1 || snapshots[0] != segments[0] {
+		t.Errorf("expected one snapshot and its segment, got snapshots %v segments %v", snapshots, segments)
+	}
+
+	reopened := openTestLogStore(t, dir, generateId)
+	got, _ := reopened.FetchAll()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchAll() after snapshot = %v, want %v", got, want)
+	}
+}
+
+func TestLogStoreTornRecord(t *testing.T) {
+	tests := []struct {
+		corrupt func(data []byte) []byte
+		name    string
+	}{
+		{
+			name: "Partial header",
+			corrupt: func(data []byte) []byte {
+				return append(data, 0, 0, 1)
+			},
+		},
+		{
+			name: "Partial payload",
+			corrupt: func(data []byte) []byte {
+				return append(data, 0, 0, 0, 100, 1, 2, 3, 4, '{')
+			},
+		},
+		{
+			name: "Bad checksum",
+			corrupt: func(data []byte) []byte {
+				data[len(data)-2] ^= 0xff
+				return data
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			generateId := sequenceId()
+
+			store := openTestLogStore(t, dir, generateId)
+			if _, err := store.Insert(&Todo{Description: "Kept"}); err != nil {
+				t.Fatalf("Insert() error %v", err)
+			}
+			if _, err := store.Insert(&Todo{Description: "Maybe kept"}); err != nil {
+				t.Fatalf("Insert() error %v", err)
+			}
+			store.Close()
+
+			path := filepath.Join(dir, segmentName(1))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.corrupt(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened := openTestLogStore(t, dir, generateId)
+			got, _ := reopened.FetchAll()
+			if len(got) == 0 || got[0].Description != "Kept" {
+				t.Fatalf("FetchAll() after recovery = %v, want the first todo kept", got)
+			}
+
+			if _, err := reopened.Insert(&Todo{Description: "After crash"}); err != nil {
+				t.Fatalf("Insert() after recovery error %v", err)
+			}
+			want, _ := reopened.FetchAll()
+			reopened.Close()
+
+			again := openTestLogStore(t, dir, generateId)
+			got, _ = again.FetchAll()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FetchAll() after second reopen = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLogStoreTxReplay(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestLogStore(t, dir, sequenceId())
+
+	tx, _ := store.Begin()
+	for _, d := range []string{"First", "Second", "Third"} {
+		if _, err := tx.Insert(&Todo{Description: d}); err != nil {
+			t.Fatalf("tx.Insert() error %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error %v", err)
+	}
+	store.Close()
+
+	mutations, _, err := readSegment(filepath.Join(dir, segmentName(1)))
+	if err != nil {
+		t.Fatalf("readSegment() error %v", err)
+	}
+	if len(mutations) != 3 {
+		t.Fatalf("readSegment() = %v, want the 3 staged inserts", mutations)
+	}
+
+	reopened := openTestLogStore(t, dir, sequenceId())
+	got, _ := reopened.FetchAll()
+	if len(got) != 3 {
+		t.Errorf("FetchAll() after reopen = %v, want 3 todos", got)
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Page is one page of the todos matching a query.
+type Page struct {
+	Todos []TodoEntity
+	// NextCursor fetches the page after this one. It is empty on the last
+	// page.
+	NextCursor string
+	// Total counts the todos matching the query on every page.
+	Total int
+}
+
+// pageCursor is the decoded form of a cursor: the sort it was made for and
+// the sort keys and Id of the last todo of its page.
+type pageCursor struct {
+	SortBy string   `json:"sortBy,omitempty"`
+	Sort   string   `json:"sort,omitempty"`
+	Keys   []string `json:"keys,omitempty"`
+	Id     string   `json:"id"`
+}
+
+// FetchPage returns up to limit todos of ops matching query, starting after
+// the todo cursor points to; an empty cursor starts at the first page and a
+// limit of 0 or less returns every remaining todo.
+//
+// Pages follow the SortBy and Sort of the query, and then the Id in the
+// direction of the last sort key, so todos sharing their sort keys are
+// neither repeated nor skipped. Without SortBy they are ordered by Id. A
+// cursor is only valid with the sort it was made for, and keeps working
+// when todos are written between pages.
+func FetchPage(ctx context.Context, ops TodoOperations, query Query, limit int, cursor string) (*Page, error) {
+	if query.Workflow == nil {
+		query.Workflow = workflowOf(ops)
+	}
+	if err := typeCheckQuery(query); err != nil {
+		return nil, err
+	}
+
+	after, err := decodeCursor(cursor, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The page is sorted here, so the store does not have to.
+	unsorted := query
+	unsorted.SortBy, unsorted.Sort = "", ""
+
+	page := &Page{Todos: make([]TodoEntity, 0)}
+	keys := query.sortKeys()
+	compare := func(e1 TodoEntity, e2 TodoEntity) int {
+		return comparePage(&e1, &e2, keys)
+	}
+
+	// Todos holds the first limit+1 todos after the cursor; the extra one
+	// tells whether there is a next page.
+	for entity, err := range ops.IterByFilter(ctx, unsorted) {
+		if err != nil {
+			return nil, err
+		}
+
+		page.Total++
+		if after != nil && compare(entity, *after) <= 0 {
+			continue
+		}
+
+		i, _ := slices.BinarySearchFunc(page.Todos, entity, compare)
+		if limit <= 0 || i <= limit {
+			page.Todos = slices.Insert(page.Todos, i, entity)
+		}
+		if limit > 0 && len(page.Todos) > limit+1 {
+			page.Todos = page.Todos[:limit+1]
+		}
+	}
+
+	if limit > 0 && len(page.Todos) > limit {
+		page.Todos = page.Todos[:limit]
+		page.NextCursor = encodeCursor(&page.Todos[limit-1], query, keys)
+	}
+
+	return page, nil
+}
+
+// FetchPageByQuery is FetchPage for a query map. Its Limit and Cursor keys
+// hold the limit and cursor, so a query string can be passed through.
+func FetchPageByQuery(ctx context.Context, ops TodoOperations, query map[string]string) (*Page, error) {
+	filters := make(map[string]string, len(query))
+	for qf, qv := range query {
+		if qf != "Limit" && qf != "Cursor" {
+			filters[qf] = qv
+		}
+	}
+
+	limit := 0
+	if value, ok := query["Limit"]; ok {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			return nil, &InvalidQueryError{Key: "Limit", Message: "Invalid Limit query value, expected 0 or more"}
+		}
+	}
+
+	compiled, err := compileQuery(filters, workflowOf(ops))
+	if err != nil {
+		return nil, err
+	}
+
+	return FetchPage(ctx, ops, compiled, limit, query["Cursor"])
+}
+
+// comparePage orders two todos by keys and then by Id in the direction of
+// the last key.
+func comparePage(entity1 *TodoEntity, entity2 *TodoEntity, keys []sortKey) int {
+	if c := sortQuery(entity1, entity2, keys); c != 0 {
+		return c
+	}
+
+	c := cmp.Compare(entity1.Id, entity2.Id)
+	if len(keys) > 0 && keys[len(keys)-1].desc {
+		return -c
+	}
+	return c
+}
+
+func encodeCursor(last *TodoEntity, query Query, keys []sortKey) string {
+	cursor := pageCursor{SortBy: query.SortBy, Sort: query.Sort, Id: last.Id}
+	for _, key := range keys {
+		var value string
+		switch key.field {
+		case "Id":
+			value = last.Id
+		case "Status":
+			value = string(last.Status)
+		case "CreatedAt":
+			value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+		case "UpdatedAt":
+			value = last.UpdatedAt.UTC().Format(time.RFC3339Nano)
+		case "Description":
+			value = last.Description
+		}
+		cursor.Keys = append(cursor.Keys, value)
+	}
+
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the todo a cursor of query points after, holding
+// only its sort key and Id, or nil for an empty cursor.
+func decodeCursor(cursor string, query Query) (*TodoEntity, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	invalid := func(message string) error {
+		return &InvalidQueryError{Key: "Cursor", Message: message}
+	}
+
+	var decoded pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &decoded) != nil {
+		return nil, invalid("Invalid Cursor query value")
+	}
+
+	if decoded.SortBy != query.SortBy || decoded.Sort != query.Sort {
+		return nil, invalid(fmt.Sprintf("Cursor was made for SortBy %q and Sort %q", decoded.SortBy, decoded.Sort))
+	}
+
+	keys := query.sortKeys()
+	if len(decoded.Keys) != len(keys) {
+		return nil, invalid("Invalid Cursor query value")
+	}
+
+	entity := &TodoEntity{Entity: Entity{Id: decoded.Id}}
+	for i, key := range keys {
+		value := decoded.Keys[i]
+		switch key.field {
+		case "Status":
+			entity.Status = TodoStatus(value)
+		case "CreatedAt", "UpdatedAt":
+			at, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, invalid("Invalid Cursor query value")
+			}
+			if key.field == "CreatedAt" {
+				entity.CreatedAt = at
+			} else {
+				entity.UpdatedAt = at
+			}
+		case "Description":
+			entity.Description = value
+		}
+	}
+
+	return entity, nil
+}
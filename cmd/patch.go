@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// immutableFields are kept by the store and cannot be changed by a patch.
+var immutableFields = []string{"Id", "CreatedAt", "UpdatedAt", "Version", "CompletedAt", "History"}
+
+// pointerEscapes unescapes the tokens of a JSON Pointer.
+var pointerEscapes = strings.NewReplacer("~1", "/", "~0", "~")
+
+// patchOperation is one operation of an RFC 6902 JSON Patch. From is nil
+// and Value empty when the operation has none; a null Value is "null".
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MergePatch applies an RFC 7396 JSON merge patch, such as
+// {"Description": "Buy milk"}, to the todo of ops with id and returns it
+// updated.
+//
+// A patch is applied to the JSON form of the TodoEntity, so it names fields
+// like FetchByQuery does. Unlike Update, a null clears a field: the patched
+// todo must then pass the rules of Insert, so Description cannot be cleared
+// and a cleared Status is reset to the first state of the workflow, if the
+// workflow allows that transition. Changing the fields the store keeps, Id,
+// CreatedAt, UpdatedAt, Version, CompletedAt and History, or adding an
+// unknown field, fails with a *ValidationError, and a malformed patch with
+// a *PatchError.
+//
+// The todo is written with UpdateIfVersion at the version the patch was
+// applied to, so a concurrent write fails with a *VersionConflictError
+// rather than being overwritten.
+func MergePatch(ctx context.Context, ops TodoOperations, id string, patch []byte) (*TodoEntity, error) {
+	var decoded any
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		return nil, &PatchError{Message: fmt.Sprintf("Invalid merge patch, %v", err)}
+	}
+
+	return patchTodo(ctx, ops, id, func(doc any) (any, error) {
+		return mergePatch(doc, decoded), nil
+	})
+}
+
+// JSONPatch applies an RFC 6902 JSON Patch, such as
+// [{"op": "replace", "path": "/Status", "value": "Done"}], to the todo of
+// ops with id and returns it updated. The operations are applied in order
+// and either all of them are or none is; a test of /Version makes the patch
+// conditional. The patched todo is checked as by MergePatch.
+func JSONPatch(ctx context.Context, ops TodoOperations, id string, patch []byte) (*TodoEntity, error) {
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, &PatchError{Message: fmt.Sprintf("Invalid JSON Patch, expected an array of operations, %v", err)}
+	}
+
+	return patchTodo(ctx, ops, id, func(doc any) (any, error) {
+		return applyJSONPatch(doc, operations)
+	})
+}
+
+// patchTodo writes the todo of ops with id as patched by apply, which is
+// handed its JSON form.
+func patchTodo(ctx context.Context, ops TodoOperations, id string, apply func(doc any) (any, error)) (*TodoEntity, error) {
+	todos, err := ops.FetchByFilterContext(ctx, Query{Filter: Eq("Id", id)})
+	if err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, &NotFoundError{Id: id}
+	}
+	entity := todos[0]
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	// The document is decoded twice, as apply may change it in place.
+	var original, doc map[string]any
+	if err := json.Unmarshal(data, &original); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	patched, err := apply(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	todo, err := patchedTodo(original, patched, workflowOf(ops))
+	if err != nil {
+		return nil, err
+	}
+
+	return ops.UpdateIfVersionContext(ctx, id, todo, entity.Version)
+}
+
+// patchedTodo checks the patched JSON form of a todo against its original
+// and returns its Todo, with the rules of Insert for workflow applied.
+func patchedTodo(original map[string]any, patched any, workflow *Workflow) (Todo, error) {
+	doc, ok := patched.(map[string]any)
+	if !ok {
+		return Todo{}, &ValidationError{Field: "Todo", Message: "The patched todo must be a JSON object"}
+	}
+
+	for _, field := range immutableFields {
+		if value, ok := doc[field]; !ok || !reflect.DeepEqual(value, original[field]) {
+			return Todo{}, &ValidationError{Field: field, Message: fmt.Sprintf("%v cannot be changed", field)}
+		}
+	}
+
+	var todo Todo
+	for field, value := range doc {
+		if slices.Contains(immutableFields, field) {
+			continue
+		}
+		if field != "Description" && field != "Status" {
+			return Todo{}, &ValidationError{Field: field, Message: fmt.Sprintf("Unknown field %v", field)}
+		}
+
+		text, ok := value.(string)
+		if !ok && value != nil {
+			return Todo{}, &ValidationError{Field: field, Message: fmt.Sprintf("%v must be a string", field)}
+		}
+		if field == "Description" {
+			todo.Description = text
+		} else {
+			todo.Status = TodoStatus(text)
+		}
+	}
+
+	return checkTodo(todo, workflow)
+}
+
+// mergePatch returns target with patch merged in, as RFC 7396 defines it.
+// Objects of target may be changed in place.
+func mergePatch(target any, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = make(map[string]any, len(fields))
+	}
+	for field, value := range fields {
+		if value == nil {
+			delete(doc, field)
+		} else {
+			doc[field] = mergePatch(doc[field], value)
+		}
+	}
+
+	return doc
+}
+
+// applyJSONPatch returns doc with operations applied in order. Objects and
+// arrays of doc may be changed in place.
+func applyJSONPatch(doc any, operations []patchOperation) (any, error) {
+	for i, op := range operations {
+		var err error
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Path: op.Path, Message: err.Error()}
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOperation(doc any, op patchOperation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (any, error) {
+		var value any
+		if len(op.Value) == 0 {
+			return nil, errors.New("Missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
+	from := func() ([]string, error) {
+		if op.From == nil {
+			return nil, errors.New("Missing from")
+		}
+		return parsePointer(*op.From)
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err := pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "move":
+		fromPath, err := from()
+		if err != nil {
+			return nil, err
+		}
+		if len(fromPath) < len(path) && slices.Equal(fromPath, path[:len(fromPath)]) {
+			return nil, errors.New("Cannot move a value into itself")
+		}
+		doc, v, err := pointerRemove(doc, fromPath)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "copy":
+		fromPath, err := from()
+		if err != nil {
+			return nil, err
+		}
+		v, err := pointerGet(doc, fromPath)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, cloneJSON(v))
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, errors.New("Test failed, the value differs")
+		}
+		return doc, nil
+	}
+
+	return nil, errors.New("Unknown operation, expected add, remove, replace, move, copy or test")
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+// The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("Invalid pointer %q, expected it to start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerEscapes.Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses the token of an array element. An index equal to size
+// is only valid where an element may be appended.
+func arrayIndex(token string, size int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || token != strconv.Itoa(index) {
+		return 0, fmt.Errorf("Invalid array index %q", token)
+	}
+	if index > size {
+		return 0, fmt.Errorf("Array index %v is out of bounds", index)
+	}
+
+	return index, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("Path does not exist, no member %q", token)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("Path does not exist, %q is not in an object or array", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerEdit returns doc with the parent of the last token of path
+// replaced by what edit returns for it.
+func pointerEdit(doc any, path []string, edit func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return edit(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("Path does not exist, no member %q", path[0])
+		}
+		child, err := pointerEdit(child, path[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []any:
+		index, err := arrayIndex(path[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerEdit(node[index], path[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("Path does not exist, %q is not in an object or array", path[0])
+}
+
+// pointerAdd sets the member of path, or inserts the element of path before
+// the one at its index; the index - appends to the array.
+func pointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return pointerEdit(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			index, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(node, index, value), nil
+		}
+		return nil, fmt.Errorf("Path does not exist, %q is not in an object or array", token)
+	})
+}
+
+// pointerRemove removes the value at path, which must exist, and returns it.
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+	doc, err := pointerEdit(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("Path does not exist, no member %q", token)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[index]
+			return slices.Delete(node, index, index+1), nil
+		}
+		return nil, fmt.Errorf("Path does not exist, %q is not in an object or array", token)
+	})
+
+	return doc, removed, err
+}
+
+// cloneJSON deeply copies a decoded JSON value.
+func cloneJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		clone := make(map[string]any, len(v))
+		for field, member := range v {
+			clone[field] = cloneJSON(member)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(v))
+		for i, element := range v {
+			clone[i] = cloneJSON(element)
+		}
+		return clone
+	}
+
+	return value
+}
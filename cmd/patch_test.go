@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data string) any {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("json.Unmarshal(%v) error %v", data, err)
+	}
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{target: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{target: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{target: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{target: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{target: `{"a":["b"]}`, patch: `{"a":["c","d"]}`, want: `{"a":["c","d"]}`},
+		{target: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+		{target: `["a"]`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{target: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range tests {
+		got := mergePatch(decodeJSON(t, tc.target), decodeJSON(t, tc.patch))
+		if want := decodeJSON(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%v, %v) = %v, want %v", tc.target, tc.patch, got, want)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Add member", doc: `{"a":1}`, patch: `[{"op":"add","path":"/b","value":2}]`, want: `{"a":1,"b":2}`},
+		{name: "Add replaces member", doc: `{"a":1}`, patch: `[{"op":"add","path":"/a","value":null}]`, want: `{"a":null}`},
+		{name: "Add element", doc: `{"a":[1,3]}`, patch: `[{"op":"add","path":"/a/1","value":2}]`, want: `{"a":[1,2,3]}`},
+		{name: "Append element", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/-","value":2}]`, want: `{"a":[1,2]}`},
+		{name: "Add whole document", doc: `{"a":1}`, patch: `[{"op":"add","path":"","value":{"b":2}}]`, want: `{"b":2}`},
+		{name: "Remove", doc: `{"a":1,"b":2}`, patch: `[{"op":"remove","path":"/a"}]`, want: `{"b":2}`},
+		{name: "Remove element", doc: `{"a":[1,2,3]}`, patch: `[{"op":"remove","path":"/a/1"}]`, want: `{"a":[1,3]}`},
+		{name: "Replace", doc: `{"a":1}`, patch: `[{"op":"replace","path":"/a","value":"x"}]`, want: `{"a":"x"}`},
+		{name: "Move", doc: `{"a":{"b":1}}`, patch: `[{"op":"move","from":"/a/b","path":"/c"}]`, want: `{"a":{},"c":1}`},
+		{name: "Copy", doc: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b","value":2}]`, want: `{"a":{"b":1},"c":{"b":2}}`},
+		{name: "Test", doc: `{"a":[1,{"b":"c"}]}`, patch: `[{"op":"test","path":"/a","value":[1,{"b":"c"}]}]`, want: `{"a":[1,{"b":"c"}]}`},
+		{name: "Escaped tokens", doc: `{"a/b":1,"m~n":2}`, patch: `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`, want: `{"m~n":3}`},
+
+		{name: "Failed test", doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":"1"}]`, wantErr: true},
+		{name: "Missing member", doc: `{"a":1}`, patch: `[{"op":"replace","path":"/b","value":1}]`, wantErr: true},
+		{name: "Missing parent", doc: `{"a":1}`, patch: `[{"op":"add","path":"/b/c","value":1}]`, wantErr: true},
+		{name: "Index out of bounds", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/2","value":1}]`, wantErr: true},
+		{name: "Leading zero index", doc: `{"a":[1,2]}`, patch: `[{"op":"remove","path":"/a/01"}]`, wantErr: true},
+		{name: "Missing value", doc: `{"a":1}`, patch: `[{"op":"add","path":"/b"}]`, wantErr: true},
+		{name: "Missing from", doc: `{"a":1}`, patch: `[{"op":"move","path":"/b"}]`, wantErr: true},
+		{name: "Move into itself", doc: `{"a":{"b":1}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, wantErr: true},
+		{name: "Invalid pointer", doc: `{"a":1}`, patch: `[{"op":"remove","path":"a"}]`, wantErr: true},
+		{name: "Unknown operation", doc: `{"a":1}`, patch: `[{"op":"increment","path":"/a"}]`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var operations []patchOperation
+			if err := json.Unmarshal([]byte(tc.patch), &operations); err != nil {
+				t.Fatalf("json.Unmarshal(%v) error %v", tc.patch, err)
+			}
+
+			got, err := applyJSONPatch(decodeJSON(t, tc.doc), operations)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidPatch) {
+					t.Errorf("applyJSONPatch() error %v, want ErrInvalidPatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyJSONPatch() error %v", err)
+			}
+			if want := decodeJSON(t, tc.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("applyJSONPatch() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FetchByQueryText parses text with the Workflow of ops and returns the
+// todos of ops matching it.
+func FetchByQueryText(ctx context.Context, ops TodoOperations, text string) ([]TodoEntity, error) {
+	query, err := workflowOf(ops).ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return ops.FetchByFilterContext(ctx, *query)
+}
+
+// queryFields maps the field names of the language to query map fields.
+var queryFields = map[string]string{
+	"id":          "Id",
+	"status":      "Status",
+	"description": "Description",
+	"desc":        "Description",
+	"created":     "CreatedAt",
+	"createdat":   "CreatedAt",
+	"updated":     "UpdatedAt",
+	"updatedat":   "UpdatedAt",
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenColon
+	tokenEq
+	tokenLt
+	tokenLtEq
+	tokenGt
+	tokenGtEq
+	tokenTilde
+	tokenCaret
+	tokenTildeEq
+	tokenEqTilde
+)
+
+var tokenSymbols = map[rune]tokenKind{
+	'(': tokenLParen,
+	')': tokenRParen,
+	':': tokenColon,
+	'=': tokenEq,
+	'<': tokenLt,
+	'>': tokenGt,
+	'~': tokenTilde,
+	'^': tokenCaret,
+}
+
+// tokenPairs are the operators of two symbols, lexed before single ones.
+var tokenPairs = map[string]tokenKind{
+	"~=": tokenTildeEq,
+	"=~": tokenEqTilde,
+	"<=": tokenLtEq,
+	">=": tokenGtEq,
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	// offset is the byte offset of the token in the query text.
+	offset int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lexQuery splits text into tokens, ending with a tokenEOF.
+func lexQuery(text string) ([]token, error) {
+	var tokens []token
+
+	for offset := 0; offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+
+		switch {
+		case unicode.IsSpace(r):
+			offset += size
+		case r == '"':
+			value, end, ok := lexString(text, offset)
+			if !ok {
+				return nil, syntaxError(text, offset, "Unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, offset: offset})
+			offset = end
+		case offset+2 <= len(text) && tokenPairs[text[offset:offset+2]] != tokenEOF:
+			tokens = append(tokens, token{kind: tokenPairs[text[offset:offset+2]], text: text[offset : offset+2], offset: offset})
+			offset += 2
+		case tokenSymbols[r] != tokenEOF:
+			tokens = append(tokens, token{kind: tokenSymbols[r], text: string(r), offset: offset})
+			offset += size
+		default:
+			end := offset
+			for end < len(text) {
+				r, size := utf8.DecodeRuneInString(text[end:])
+				if unicode.IsSpace(r) || r == '"' || tokenSymbols[r] != tokenEOF {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: text[offset:end], offset: offset})
+			offset = end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, offset: len(text)}), nil
+}
+
+// lexString reads the quoted string starting at offset. A backslash escapes
+// the rune after it.
+func lexString(text string, offset int) (string, int, bool) {
+	var value strings.Builder
+
+	for i := offset + 1; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch r {
+		case '"':
+			return value.String(), i + size, true
+		case '\\':
+			i += size
+			if i >= len(text) {
+				return "", 0, false
+			}
+			r, size = utf8.DecodeRuneInString(text[i:])
+		}
+		value.WriteRune(r)
+		i += size
+	}
+
+	return "", 0, false
+}
+
+func syntaxError(text string, offset int, message string) *QuerySyntaxError {
+	return &QuerySyntaxError{Offset: offset, Column: column(text, offset), Message: message}
+}
+
+// column returns the 1-based rune position of the byte offset in text.
+func column(text string, offset int) int {
+	return utf8.RuneCountInString(text[:offset]) + 1
+}
+
+type queryParser struct {
+	text     string
+	tokens   []token
+	pos      int
+	workflow *Workflow
+}
+
+// ParseQuery parses a query written in the query language, for example
+//
+//	status:NotDone and (created<2024-11-10 or description~"deploy") sort:-created
+//
+// Comparisons are field, operator and value. The fields are id, status,
+// description (or desc), created and updated; the operators are : or = for
+// equality, < and > for days before or after a date, and for descriptions
+// ~ (contains), ^ (starts with), ~= (equal ignoring case) and =~ (matches
+// the regular expression). Values holding spaces or operators are quoted.
+// Comparisons are combined with and, or, not and parentheses, and a
+// comparison next to another is and-ed with it. A trailing sort:field sorts
+// ascending and sort:-field descending; sort:status,-updated,id sorts by
+// several fields, each breaking the ties of the ones before it.
+//
+// created and updated also take <= and >=, and a range such as
+// created:2024-11-01..2024-11-10 that includes both days. Their values are
+// dates, now, today, yesterday, tomorrow, offsets from now such as -7d or
+// -3h, and RFC 3339 timestamps, which are quoted:
+// created>="2024-11-10T23:30:00-03:00".
+//
+// A status is a state of DefaultWorkflow or one of its groups, such as
+// status:open, in any case.
+//
+// An empty text matches every todo. Errors are *QuerySyntaxError.
+func ParseQuery(text string) (*Query, error) {
+	return DefaultWorkflow.ParseQuery(text)
+}
+
+// ParseQuery is the package ParseQuery for the states and groups of w.
+func (w *Workflow) ParseQuery(text string) (*Query, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{text: text, tokens: tokens, workflow: w}
+	query := &Query{}
+
+	if p.startsComparison() {
+		if query.Filter, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isKeyword("sort") {
+		if err := p.parseSort(query); err != nil {
+			return nil, err
+		}
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorAt(t, fmt.Sprintf("Unexpected %v", t))
+	}
+
+	return query, nil
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) advance() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// startsComparison reports whether the next token can start an operand of
+// and, which makes and optional between comparisons.
+func (p *queryParser) startsComparison() bool {
+	t := p.peek()
+	switch t.kind {
+	case tokenLParen:
+		return true
+	case tokenWord:
+		return !p.isKeyword("and") && !p.isKeyword("or") && !p.isKeyword("sort")
+	}
+	return false
+}
+
+func (p *queryParser) errorAt(t token, message string) *QuerySyntaxError {
+	return syntaxError(p.text, t.offset, message)
+}
+
+func (p *queryParser) parseOr() (Filter, error) {
+	var filters []Filter
+
+	for {
+		filter, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+
+		if !p.isKeyword("or") {
+			break
+		}
+		p.advance()
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return OrFilter{Filters: filters}, nil
+}
+
+func (p *queryParser) parseAnd() (Filter, error) {
+	var filters []Filter
+
+	for {
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+
+		if p.isKeyword("and") {
+			p.advance()
+		} else if !p.startsComparison() {
+			break
+		}
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return AndFilter{Filters: filters}, nil
+}
+
+func (p *queryParser) parseNot() (Filter, error) {
+	if p.isKeyword("not") {
+		p.advance()
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return NotFilter{Filter: filter}, nil
+	}
+
+	if open := p.peek(); open.kind == tokenLParen {
+		p.advance()
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t.kind != tokenRParen {
+			return nil, p.errorAt(t, fmt.Sprintf("Expected ) to close the ( at column %v, got %v", column(p.text, open.offset), t))
+		}
+		p.advance()
+		return filter, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (Filter, error) {
+	name := p.advance()
+	if name.kind != tokenWord {
+		return nil, p.errorAt(name, fmt.Sprintf("Expected a field, got %v", name))
+	}
+
+	field, ok := queryFields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, p.errorAt(name, fmt.Sprintf("Unknown field %q, expected id, status, description, created or updated", name.text))
+	}
+
+	opToken := p.advance()
+	var op FilterOp
+	switch opToken.kind {
+	case tokenColon, tokenEq:
+		op = OpEq
+	case tokenLt:
+		op = OpLt
+	case tokenLtEq:
+		op = OpLte
+	case tokenGt:
+		op = OpGt
+	case tokenGtEq:
+		op = OpGte
+	case tokenTilde:
+		op = OpContains
+	case tokenCaret:
+		op = OpPrefix
+	case tokenTildeEq:
+		op = OpEqualFold
+	case tokenEqTilde:
+		op = OpRegex
+	default:
+		return nil, p.errorAt(opToken, fmt.Sprintf("Expected an operator after %v, got %v", name.text, opToken))
+	}
+
+	valueToken := p.advance()
+	if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+		return nil, p.errorAt(valueToken, fmt.Sprintf("Expected a value for %v, got %v", name.text, valueToken))
+	}
+
+	value := valueToken.text
+	if op == OpEq && (field == "CreatedAt" || field == "UpdatedAt") && strings.Contains(value, "..") {
+		op = OpBetween
+	}
+	if field == "Status" {
+		// Statuses are matched exactly; the language lets them be typed in
+		// any case.
+		for _, status := range p.workflow.queryValues() {
+			if strings.EqualFold(value, status) {
+				value = status
+			}
+		}
+	}
+
+	filter := FieldFilter{Field: field, Op: op, Value: value}
+	if message, opErr := checkFieldFilter(filter, p.workflow); opErr {
+		return nil, p.errorAt(opToken, fmt.Sprintf("Operator %v is not supported for %v", opToken.text, name.text))
+	} else if message != "" {
+		return nil, p.errorAt(valueToken, message)
+	}
+
+	return filter, nil
+}
+
+func (p *queryParser) parseSort(query *Query) error {
+	p.advance()
+
+	if t := p.advance(); t.kind != tokenColon {
+		return p.errorAt(t, fmt.Sprintf("Expected : after sort, got %v", t))
+	}
+
+	t := p.advance()
+	if t.kind != tokenWord {
+		return p.errorAt(t, fmt.Sprintf("Expected a field to sort by, got %v", t))
+	}
+
+	var fields, directions []string
+	offset := t.offset
+	for _, name := range strings.Split(t.text, ",") {
+		key := name
+
+		direction := "asc"
+		if rest, ok := strings.CutPrefix(name, "-"); ok {
+			name, direction = rest, "desc"
+		} else if rest, ok := strings.CutPrefix(name, "+"); ok {
+			name = rest
+		}
+
+		field, ok := queryFields[strings.ToLower(name)]
+		if !ok {
+			return syntaxError(p.text, offset, fmt.Sprintf("Cannot sort by %q, expected id, status, description, created or updated", name))
+		}
+		if slices.Contains(fields, field) {
+			return syntaxError(p.text, offset, fmt.Sprintf("Sorted by %v twice", name))
+		}
+
+		fields = append(fields, field)
+		directions = append(directions, direction)
+		offset += len(key) + 1
+	}
+
+	query.SortBy = strings.Join(fields, ",")
+	query.Sort = strings.Join(directions, ",")
+
+	return nil
+}
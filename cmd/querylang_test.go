@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		want *Query
+		text string
+	}{
+		{
+			text: "",
+			want: &Query{},
+		},
+		{
+			text: "status:NotDone and (created<2024-11-10 or description~\"deploy\") sort:-created",
+			want: &Query{
+				Filter: AndFilter{Filters: []Filter{
+					FieldFilter{Field: "Status", Op: OpEq, Value: "NotDone"},
+					OrFilter{Filters: []Filter{
+						FieldFilter{Field: "CreatedAt", Op: OpLt, Value: "2024-11-10"},
+						FieldFilter{Field: "Description", Op: OpContains, Value: "deploy"},
+					}},
+				}},
+				SortBy: "CreatedAt",
+				Sort:   "desc",
+			},
+		},
+		{
+			text: "STATUS=done updated>2024-01-01 OR not not id:7",
+			want: &Query{
+				Filter: OrFilter{Filters: []Filter{
+					AndFilter{Filters: []Filter{
+						FieldFilter{Field: "Status", Op: OpEq, Value: "Done"},
+						FieldFilter{Field: "UpdatedAt", Op: OpGt, Value: "2024-01-01"},
+					}},
+					NotFilter{Filter: NotFilter{Filter: FieldFilter{Field: "Id", Op: OpEq, Value: "7"}}},
+				}},
+			},
+		},
+		{
+			text: `desc:"say \"hi\" or (not)" sort:+Description`,
+			want: &Query{
+				Filter: FieldFilter{Field: "Description", Op: OpEq, Value: `say "hi" or (not)`},
+				SortBy: "Description",
+				Sort:   "asc",
+			},
+		},
+		{
+			text: `created>=-7d updated<="2024-11-10T23:30:00-03:00" created:2024-11-01..today`,
+			want: &Query{
+				Filter: AndFilter{Filters: []Filter{
+					FieldFilter{Field: "CreatedAt", Op: OpGte, Value: "-7d"},
+					FieldFilter{Field: "UpdatedAt", Op: OpLte, Value: "2024-11-10T23:30:00-03:00"},
+					FieldFilter{Field: "CreatedAt", Op: OpBetween, Value: "2024-11-01..today"},
+				}},
+			},
+		},
+		{
+			text: "sort:status,-updated,+id",
+			want: &Query{SortBy: "Status,UpdatedAt,Id", Sort: "asc,desc,asc"},
+		},
+		{
+			text: `desc^Fix desc~=" fix the BUILD" desc=~"^fix (ci|build)$"`,
+			want: &Query{
+				Filter: AndFilter{Filters: []Filter{
+					FieldFilter{Field: "Description", Op: OpPrefix, Value: "Fix"},
+					FieldFilter{Field: "Description", Op: OpEqualFold, Value: " fix the BUILD"},
+					FieldFilter{Field: "Description", Op: OpRegex, Value: "^fix (ci|build)$"},
+				}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			got, err := ParseQuery(tc.text)
+			if err != nil {
+				t.Fatalf("ParseQuery() error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseQuery() = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		text       string
+		wantColumn int
+	}{
+		{text: "status", wantColumn: 7},
+		{text: "priority:high", wantColumn: 1},
+		{text: "status:Maybe", wantColumn: 8},
+		{text: "status<Done", wantColumn: 7},
+		{text: "created:2024-13-01", wantColumn: 9},
+		{text: "created~2024", wantColumn: 8},
+		{text: "created:2024-11-01..someday", wantColumn: 9},
+		{text: "created>=-7x", wantColumn: 10},
+		{text: "id^12", wantColumn: 3},
+		{text: `desc=~"(unclosed"`, wantColumn: 7},
+		{text: "(id:1 or id:2", wantColumn: 14},
+		{text: "id:1 and", wantColumn: 9},
+		{text: "id:1)", wantColumn: 5},
+		{text: `description:"open`, wantColumn: 13},
+		{text: "sort:-priority", wantColumn: 6},
+		{text: "sort:id,-priority", wantColumn: 9},
+		{text: "sort:created,-created", wantColumn: 14},
+		{text: "sort:id id:1", wantColumn: 9},
+		{text: "é id:1", wantColumn: 1},
+		{text: "id:1 é:2", wantColumn: 6},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			_, err := ParseQuery(tc.text)
+
+			var syntaxErr *QuerySyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseQuery() error %v, want a *QuerySyntaxError", err)
+			}
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("ParseQuery() error %v, want ErrInvalidQuery", err)
+			}
+			if syntaxErr.Column != tc.wantColumn {
+				t.Errorf("ParseQuery() error at column %v, want %v: %v", syntaxErr.Column, tc.wantColumn, err)
+			}
+		})
+	}
+}
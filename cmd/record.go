@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordFields are the fields a Record can hold, in the order FetchRecords
+// uses when none are asked for.
+var recordFields = []string{"Id", "Description", "Status", "CreatedAt", "UpdatedAt", "Version"}
+
+// Record holds some fields of a todo, in the order they were asked for.
+// Values[i] is the value of Fields[i]: a string for Id and Description, a
+// TodoStatus, a time.Time for CreatedAt and UpdatedAt and an int64 Version.
+// The records of a query share their Fields.
+type Record struct {
+	Fields []string
+	Values []any
+}
+
+// Get returns the value of field, or false if r does not hold it.
+func (r Record) Get(field string) (any, bool) {
+	if i := slices.Index(r.Fields, field); i >= 0 {
+		return r.Values[i], true
+	}
+
+	return nil, false
+}
+
+// Strings returns the values of r as text, for CSV and table renderers.
+// Timestamps are RFC 3339 in UTC.
+func (r Record) Strings() []string {
+	result := make([]string, len(r.Values))
+	for i, value := range r.Values {
+		switch v := value.(type) {
+		case time.Time:
+			result[i] = v.UTC().Format(time.RFC3339Nano)
+		case int64:
+			result[i] = strconv.FormatInt(v, 10)
+		default:
+			result[i] = fmt.Sprint(v)
+		}
+	}
+
+	return result
+}
+
+// MarshalJSON encodes r as an object holding its fields in order.
+// Timestamps are RFC 3339 in UTC, as in Strings.
+func (r Record) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range r.Fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(field)
+		v := r.Values[i]
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC()
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// FetchRecords returns the todos of ops matching query reduced to fields,
+// in the order of the query. Without fields the records hold every field.
+func FetchRecords(ctx context.Context, ops TodoOperations, query Query, fields ...string) ([]Record, error) {
+	if len(fields) == 0 {
+		fields = recordFields
+	}
+	if err := checkRecordFields(fields); err != nil {
+		return nil, err
+	}
+	fields = slices.Clone(fields)
+
+	records := make([]Record, 0)
+	for entity, err := range ops.IterByFilter(ctx, query) {
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, project(&entity, fields))
+	}
+
+	return records, nil
+}
+
+// FetchRecordsByQuery is FetchRecords for a query map. Its Fields key lists
+// the fields separated by commas, such as Id,Description,Status.
+func FetchRecordsByQuery(ctx context.Context, ops TodoOperations, query map[string]string) ([]Record, error) {
+	filters := make(map[string]string, len(query))
+	for qf, qv := range query {
+		if qf != "Fields" {
+			filters[qf] = qv
+		}
+	}
+
+	var fields []string
+	if value, ok := query["Fields"]; ok {
+		fields = strings.Split(value, ",")
+	}
+
+	compiled, err := compileQuery(filters, workflowOf(ops))
+	if err != nil {
+		return nil, err
+	}
+
+	return FetchRecords(ctx, ops, compiled, fields...)
+}
+
+func checkRecordFields(fields []string) error {
+	for i, field := range fields {
+		if !slices.Contains(recordFields, field) {
+			return &InvalidQueryError{Key: "Fields", Message: fmt.Sprintf("Invalid field %q, expected %v", field, strings.Join(recordFields, ", "))}
+		}
+		if slices.Contains(fields[:i], field) {
+			return &InvalidQueryError{Key: "Fields", Message: fmt.Sprintf("Invalid Fields, %v is asked for twice", field)}
+		}
+	}
+
+	return nil
+}
+
+// project builds the record of entity holding fields, which must be valid.
+func project(entity *TodoEntity, fields []string) Record {
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "Id":
+			values[i] = entity.Id
+		case "Description":
+			values[i] = entity.Description
+		case "Status":
+			values[i] = entity.Status
+		case "CreatedAt":
+			values[i] = entity.CreatedAt
+		case "UpdatedAt":
+			values[i] = entity.UpdatedAt
+		case "Version":
+			values[i] = entity.Version
+		}
+	}
+
+	return Record{Fields: fields, Values: values}
+}
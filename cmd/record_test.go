@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	entity := &TodoEntity{
+		Entity: Entity{Id: "7", CreatedAt: time.Date(2024, 11, 10, 23, 30, 0, 0, time.FixedZone("UTC-3", -3*60*60)), Version: 3},
+		Todo:   Todo{Description: `Say "hi"`, Status: StatusDone},
+	}
+	record := project(entity, []string{"Status", "Id", "Description", "CreatedAt", "Version"})
+
+	if got, want := record.Strings(), []string{"Done", "7", `Say "hi"`, "2024-11-11T02:30:00Z", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Strings() = %q, want %q", got, want)
+	}
+
+	data, err := json.Marshal([]Record{record})
+	if err != nil {
+		t.Fatalf("json.Marshal() error %v", err)
+	}
+	if want := `[{"Status":"Done","Id":"7","Description":"Say \"hi\"","CreatedAt":"2024-11-11T02:30:00Z","Version":3}]`; string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+
+	if value, ok := record.Get("Version"); !ok || value != int64(3) {
+		t.Errorf("Get(Version) = %v, %v, want 3, true", value, ok)
+	}
+	if _, ok := record.Get("UpdatedAt"); ok {
+		t.Errorf("Get(UpdatedAt) found a field the record does not hold")
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"regexp"
+	"sync"
+)
+
+// regexCacheSize bounds the number of compiled patterns kept by
+// compileRegex. The cache is emptied when it fills up.
+const regexCacheSize = 256
+
+var regexCache = struct {
+	sync.RWMutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// compileRegex compiles pattern, reusing the result of earlier calls so
+// queries don't recompile it for every todo they check.
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.RLock()
+	re, ok := regexCache.patterns[pattern]
+	regexCache.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if len(regexCache.patterns) >= regexCacheSize {
+		clear(regexCache.patterns)
+	}
+	regexCache.patterns[pattern] = re
+
+	return re, nil
+}
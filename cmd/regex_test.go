@@ -0,0 +1,22 @@
+package cmd
+
+import "testing"
+
+func TestCompileRegex(t *testing.T) {
+	first, err := compileRegex(`deploy \d+`)
+	if err != nil {
+		t.Fatalf("compileRegex() error %v", err)
+	}
+	second, _ := compileRegex(`deploy \d+`)
+	if first != second {
+		t.Errorf("compileRegex() compiled a cached pattern again")
+	}
+
+	if _, err := compileRegex("deploy("); err == nil {
+		t.Errorf("compileRegex() expected an error")
+	}
+
+	if !filterString("deploy 42", `deploy \d+`) || filterString("deploy", "deploy(") {
+		t.Errorf("filterString() did not use the compiled pattern")
+	}
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// BM25 parameters: bm25K1 dampens repeated terms and bm25B sets how much
+// long descriptions are penalized.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchHit is a todo found by Search, with its BM25 score and the parts
+// of its text that matched the query.
+type SearchHit struct {
+	TodoEntity
+	Score      float64
+	Highlights []Highlight
+}
+
+// Highlight is the byte range [Start, End) of a Field that matched a query
+// term.
+type Highlight struct {
+	Field string
+	Start int
+	End   int
+}
+
+// searchStopWords are dropped from both the indexed text and the queries.
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "from": true, "if": true,
+	"in": true, "into": true, "is": true, "it": true, "of": true, "on": true,
+	"or": true, "so": true, "than": true, "that": true, "the": true, "then": true,
+	"this": true, "to": true, "was": true, "were": true, "will": true, "with": true,
+}
+
+// searchField is a piece of text of a todo the search index covers.
+type searchField struct {
+	name string
+	text string
+}
+
+// searchFields returns the text of entity that Search looks at.
+func searchFields(entity *TodoEntity) []searchField {
+	return []searchField{{name: "Description", text: entity.Description}}
+}
+
+// searchToken is an indexed term and where it was found in its text.
+type searchToken struct {
+	term  string
+	start int
+	end   int
+}
+
+// tokenize splits text into words of letters and digits and turns each one
+// into a term: Unicode compatibility decomposition without combining marks,
+// lowercase, then stemmed. Stop words are left out.
+func tokenize(text string) []searchToken {
+	var tokens []searchToken
+
+	start := -1
+	for offset := 0; offset <= len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		inWord := offset < len(text) && (unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r))
+
+		if inWord && start < 0 {
+			start = offset
+		} else if !inWord && start >= 0 {
+			if term := normalizeTerm(text[start:offset]); term != "" && !searchStopWords[term] {
+				tokens = append(tokens, searchToken{term: stem(term), start: start, end: offset})
+			}
+			start = -1
+		}
+
+		if offset == len(text) {
+			break
+		}
+		offset += size
+	}
+
+	return tokens
+}
+
+func normalizeTerm(word string) string {
+	if isASCII(word) {
+		return strings.ToLower(word)
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(word) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stem strips common English inflections so deploys, deployed and
+// deploying all index as deploy.
+func stem(term string) string {
+	if len(term) <= 3 {
+		return term
+	}
+
+	switch {
+	case strings.HasSuffix(term, "sses"):
+		return strings.TrimSuffix(term, "es")
+	case strings.HasSuffix(term, "ies") && len(term) > 4:
+		return strings.TrimSuffix(term, "ies") + "y"
+	case strings.HasSuffix(term, "ing") && len(term) > 5:
+		return undouble(strings.TrimSuffix(term, "ing"))
+	case strings.HasSuffix(term, "ed") && len(term) > 4:
+		return undouble(strings.TrimSuffix(term, "ed"))
+	case strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss") && !strings.HasSuffix(term, "us"):
+		return strings.TrimSuffix(term, "s")
+	}
+
+	return term
+}
+
+// undouble drops the last letter of a stem ending in a doubled consonant,
+// as in running, but not in fall or miss.
+func undouble(stem string) string {
+	n := len(stem)
+	if n < 2 || stem[n-1] != stem[n-2] || strings.IndexByte("aeioulsz", stem[n-1]) >= 0 {
+		return stem
+	}
+
+	return stem[:n-1]
+}
+
+// posting is how often a term occurs in the todo with a sequence number of
+// its todoIndex.
+type posting struct {
+	seq  int
+	freq int
+}
+
+// textIndex is an inverted index over the searchFields of the todos of a
+// todoIndex. Its postings are kept in ascending sequence number order.
+type textIndex struct {
+	postings map[string][]posting
+	// lengths holds the number of terms of every sequence number.
+	lengths map[int]int
+	total   int
+}
+
+func buildTextIndex(list []TodoEntity, seqs []int) *textIndex {
+	text := &textIndex{postings: make(map[string][]posting), lengths: make(map[int]int, len(list))}
+	for p := range list {
+		text.insert(seqs[p], &list[p])
+	}
+
+	return text
+}
+
+func entityTerms(entity *TodoEntity) map[string]int {
+	freqs := make(map[string]int)
+	for _, field := range searchFields(entity) {
+		for _, t := range tokenize(field.text) {
+			freqs[t.term]++
+		}
+	}
+
+	return freqs
+}
+
+// add indexes entity with the sequence number seq, whose length must exist.
+func (text *textIndex) add(seq int, entity *TodoEntity) {
+	for term, freq := range entityTerms(entity) {
+		postings := text.postings[term]
+		i, _ := slices.BinarySearchFunc(postings, seq, comparePosting)
+		text.postings[term] = slices.Insert(postings, i, posting{seq: seq, freq: freq})
+		text.lengths[seq] += freq
+		text.total += freq
+	}
+}
+
+// remove takes entity, indexed with the sequence number seq, out of the
+// postings.
+func (text *textIndex) remove(seq int, entity *TodoEntity) {
+	for term := range entityTerms(entity) {
+		postings := text.postings[term]
+		if i, found := slices.BinarySearchFunc(postings, seq, comparePosting); found {
+			postings = slices.Delete(postings, i, i+1)
+		}
+		if len(postings) == 0 {
+			delete(text.postings, term)
+		} else {
+			text.postings[term] = postings
+		}
+	}
+
+	text.total -= text.lengths[seq]
+	text.lengths[seq] = 0
+}
+
+func comparePosting(p posting, seq int) int {
+	return cmp.Compare(p.seq, seq)
+}
+
+// insert indexes entity with the new sequence number seq.
+func (text *textIndex) insert(seq int, entity *TodoEntity) {
+	text.lengths[seq] = 0
+	text.add(seq, entity)
+}
+
+// update re-indexes the todo with the sequence number seq if its text
+// changed.
+func (text *textIndex) update(seq int, old *TodoEntity, entity *TodoEntity) {
+	if slices.Equal(searchFields(old), searchFields(entity)) {
+		return
+	}
+
+	text.remove(seq, old)
+	text.add(seq, entity)
+}
+
+// delete removes the todo with the sequence number seq.
+func (text *textIndex) delete(seq int, old *TodoEntity) {
+	text.remove(seq, old)
+	delete(text.lengths, seq)
+}
+
+// scores returns the BM25 score of every sequence number holding one of
+// terms.
+func (text *textIndex) scores(terms []string) map[int]float64 {
+	scores := make(map[int]float64)
+
+	n := float64(len(text.lengths))
+	if n == 0 {
+		return scores
+	}
+	avgLength := float64(text.total) / n
+
+	for _, term := range terms {
+		postings := text.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for _, p := range postings {
+			tf := float64(p.freq)
+			lengthNorm := 1 - bm25B + bm25B*float64(text.lengths[p.seq])/avgLength
+			scores[p.seq] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*lengthNorm)
+		}
+	}
+
+	return scores
+}
+
+// textIndex returns the full-text index of the TodoList, building it on the
+// first search. The caller must hold a lock.
+func (r *TodoRepository) textIndex() *textIndex {
+	idx := r.index()
+
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	if idx.text == nil {
+		idx.text = buildTextIndex(idx.list, idx.seqs)
+	}
+
+	return idx.text
+}
+
+func (r *TodoRepository) Search(query string, limit int) ([]SearchHit, error) {
+	return r.SearchContext(context.Background(), query, limit)
+}
+
+// SearchContext ranks the todos holding any term of query with BM25 and
+// returns the best limit of them, best first; a limit of 0 or less returns
+// every hit. Query text goes through the same tokenization, normalization,
+// stop words and stemming as the indexed text.
+func (r *TodoRepository) SearchContext(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.TodoList == nil {
+		return nil, ErrNotInitialized
+	}
+
+	terms := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		terms[t.term] = true
+	}
+
+	scores := r.textIndex().scores(slices.Sorted(maps.Keys(terms)))
+
+	// Sequence numbers ascend with positions, so ties keep TodoList order.
+	seqs := make([]int, 0, len(scores))
+	for seq := range scores {
+		seqs = append(seqs, seq)
+	}
+	slices.SortFunc(seqs, func(s1 int, s2 int) int {
+		if c := cmp.Compare(scores[s2], scores[s1]); c != 0 {
+			return c
+		}
+		return cmp.Compare(s1, s2)
+	})
+
+	if limit > 0 && len(seqs) > limit {
+		seqs = seqs[:limit]
+	}
+
+	idx := r.index()
+	hits := make([]SearchHit, 0, len(seqs))
+	for _, seq := range seqs {
+		entity := *idx.entity(seq)
+		hit := SearchHit{TodoEntity: entity, Score: scores[seq]}
+
+		for _, field := range searchFields(&entity) {
+			for _, t := range tokenize(field.text) {
+				if terms[t.term] {
+					hit.Highlights = append(hit.Highlights, Highlight{Field: field.name, Start: t.start, End: t.end})
+				}
+			}
+		}
+
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
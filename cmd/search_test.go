@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Deploy the staging cluster", want: []string{"deploy", "stag", "cluster"}},
+		{text: "Deployed, DEPLOYS and deploying!", want: []string{"deploy", "deploy", "deploy"}},
+		{text: "Café crème brûlée", want: []string{"cafe", "creme", "brulee"}},
+		{text: "ﬁx ＡＰＩ retries", want: []string{"fix", "api", "retry"}},
+		{text: "running tests in the status bus", want: []string{"run", "test", "status", "bus"}},
+		{text: "to be or not", want: []string{"not"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			var got []string
+			for _, token := range tokenize(tc.text) {
+				got = append(got, token.term)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("tokenize() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func newSearchRepository(t testing.TB, descriptions ...string) *TodoRepository {
+	repository := &TodoRepository{GenerateId: sequenceId(), Clock: fixedClock, TodoList: make([]TodoEntity, 0)}
+	for _, d := range descriptions {
+		if _, err := repository.Insert(&Todo{Description: d}); err != nil {
+			t.Fatalf("Insert() error %v", err)
+		}
+	}
+
+	return repository
+}
+
+func hitIds(hits []SearchHit) []string {
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.Id)
+	}
+
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	repository := newSearchRepository(t,
+		"Deploy staging cluster",
+		"Write deployment notes for the staging deploy and deploy again",
+		"Buy milk",
+		"Review the café menu",
+	)
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{query: "deploy", want: []string{"2", "1"}},
+		{query: "deploying staging", limit: 1, want: []string{"1"}},
+		{query: "CAFE", want: []string{"4"}},
+		{query: "the", want: []string{}},
+		{query: "kubernetes", want: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			hits, err := repository.Search(tc.query, tc.limit)
+			if err != nil {
+				t.Fatalf("Search() error %v", err)
+			}
+			if got := hitIds(hits); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Search() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	hits, _ := repository.Search("cafe", 0)
+	want := []Highlight{{Field: "Description", Start: 11, End: 16}}
+	if len(hits) != 1 || !reflect.DeepEqual(hits[0].Highlights, want) || hits[0].Score <= 0 {
+		t.Errorf("Search() = %+v, want one scored hit highlighting %v", hits, want)
+	}
+}
+
+func TestSearchFollowsWrites(t *testing.T) {
+	repository := newSearchRepository(t, "Deploy staging", "Deploy production", "Buy milk")
+
+	// Build the text index before writing so the writes must maintain it.
+	if _, err := repository.Search("deploy", 0); err != nil {
+		t.Fatalf("Search() error %v", err)
+	}
+
+	if _, err := repository.Insert(&Todo{Description: "Deploy docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.Update("2", Todo{Description: "Buy bread"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, _ := repository.Search("deploy", 0)
+	if got := hitIds(hits); !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("Search(deploy) = %v, want [4]", got)
+	}
+	hits, _ = repository.Search("buy", 0)
+	if got := hitIds(hits); len(got) != 2 {
+		t.Errorf("Search(buy) = %v, want 2 hits", got)
+	}
+
+	rebuilt := buildTodoIndex(repository.TodoList)
+	if !reflect.DeepEqual(renumbered(repository.idx).text, buildTextIndex(rebuilt.list, rebuilt.seqs)) {
+		t.Errorf("maintained text index differs from a rebuilt one")
+	}
+
+	if _, err := (&TodoRepository{}).Search("deploy", 0); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Search() error %v, want ErrNotInitialized", err)
+	}
+}
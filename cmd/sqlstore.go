@@ -0,0 +1,855 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqlTimeLayout keeps timestamps in UTC with a fixed width, so they sort
+// lexically and their first 10 characters are the day.
+const sqlTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// The Description operators SQLite has no exact equivalent for run the Go
+// matching code as SQL functions, so both stores agree on every match.
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("todo_match", 3, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		field, _ := args[0].(string)
+		op, _ := args[1].(string)
+		value, _ := args[2].(string)
+
+		return matchString(field, FilterOp(op), value), nil
+	})
+}
+
+// migration is one step of the schema. Migrations run in Version order and
+// each one runs at most once per database.
+type migration struct {
+	Version    int
+	Statements []string
+}
+
+var sqlMigrations = []migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE todos (
+				id          TEXT PRIMARY KEY,
+				created_at  TEXT NOT NULL,
+				updated_at  TEXT NOT NULL,
+				description TEXT NOT NULL,
+				status      TEXT NOT NULL
+			)`,
+			`CREATE INDEX todos_created_at ON todos (created_at)`,
+			`CREATE INDEX todos_status ON todos (status)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// history holds the History of a todo as JSON, or NULL if it has
+		// none, and completed_at is NULL until the todo is completed.
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE todos ADD COLUMN completed_at TEXT`,
+			`ALTER TABLE todos ADD COLUMN history TEXT`,
+		},
+	},
+}
+
+// sqlColumns maps query fields to their column.
+var sqlColumns = map[string]string{
+	"Id":          "id",
+	"CreatedAt":   "created_at",
+	"UpdatedAt":   "updated_at",
+	"Description": "description",
+	"Status":      "status",
+}
+
+// SQLStore keeps todos in a SQLite-compatible database. It is safe for
+// concurrent use as long as GenerateId is. Regex and case-insensitive
+// Description filters call todo_match, which is only registered with the
+// modernc.org/sqlite driver.
+//
+// Location is the time zone whole days of queries start in, unless a Query
+// sets its own; nil means UTC.
+type SQLStore struct {
+	DB         *sql.DB
+	GenerateId GenerateId
+	Clock      Clock
+	Audit      Audit
+	Location   *time.Location
+	// Workflow is the state machine of the statuses; nil means
+	// DefaultWorkflow.
+	Workflow *Workflow
+}
+
+var _ TodoStore = (*SQLStore)(nil)
+
+// sqliteOptions let readers run alongside a writer and make concurrent
+// writers wait for each other instead of failing with SQLITE_BUSY.
+const sqliteOptions = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// sqliteURIPath escapes the characters that end or escape the path of a
+// SQLite URI filename.
+var sqliteURIPath = strings.NewReplacer("%", "%25", "?", "%3F", "#", "%23")
+
+// OpenSQLiteStore opens, or creates, the SQLite database at path and
+// migrates it to the latest schema.
+func OpenSQLiteStore(path string, generateId GenerateId, clock Clock) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", "file:"+sqliteURIPath.Replace(path)+"?"+sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLStore(db, generateId, clock)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// NewSQLStore migrates db to the latest schema and wraps it in a SQLStore.
+func NewSQLStore(db *sql.DB, generateId GenerateId, clock Clock) (*SQLStore, error) {
+	if err := migrate(db, sqlMigrations); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		DB:         db,
+		GenerateId: generateId,
+		Clock:      clock,
+	}, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.DB.Close()
+}
+
+// migrate applies the migrations newer than the version recorded in
+// schema_migrations, each one in its own transaction.
+func migrate(db *sql.DB, migrations []migration) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	pending := slices.Clone(migrations)
+	slices.SortFunc(pending, func(m1 migration, m2 migration) int {
+		return m1.Version - m2.Version
+	})
+
+	for _, m := range pending {
+		if m.Version <= current {
+			continue
+		}
+
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("Migration %v failed: %w", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.Statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+		m.Version, time.Now().UTC().Format(sqlTimeLayout),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+// sqlConn is implemented by both *sql.DB and *sql.Tx.
+type sqlConn interface {
+	sqlExecer
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const sqlSelectTodo = `SELECT id, created_at, updated_at, version, description, status, completed_at, history FROM todos`
+
+func insertSQLEntity(ctx context.Context, db sqlExecer, entity *TodoEntity) error {
+	completedAt, history, err := sqlCompletion(entity)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(
+		ctx,
+		`INSERT INTO todos (id, created_at, updated_at, version, description, status, completed_at, history) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entity.Id,
+		entity.CreatedAt.UTC().Format(sqlTimeLayout),
+		entity.UpdatedAt.UTC().Format(sqlTimeLayout),
+		entity.Version,
+		entity.Description,
+		string(entity.Status),
+		completedAt,
+		history,
+	)
+	return err
+}
+
+// sqlCompletion returns the completed_at and history columns of entity.
+func sqlCompletion(entity *TodoEntity) (completedAt sql.NullString, history sql.NullString, err error) {
+	if !entity.CompletedAt.IsZero() {
+		completedAt = sql.NullString{String: entity.CompletedAt.UTC().Format(sqlTimeLayout), Valid: true}
+	}
+
+	if entity.History != nil {
+		data, err := json.Marshal(entity.History)
+		if err != nil {
+			return completedAt, history, err
+		}
+		history = sql.NullString{String: string(data), Valid: true}
+	}
+
+	return completedAt, history, nil
+}
+
+func scanSQLEntity(row sqlScanner) (*TodoEntity, error) {
+	var entity TodoEntity
+	var createdAt, updatedAt, status string
+	var completedAt, history sql.NullString
+
+	if err := row.Scan(&entity.Id, &createdAt, &updatedAt, &entity.Version, &entity.Description, &status, &completedAt, &history); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if entity.CreatedAt, err = time.Parse(sqlTimeLayout, createdAt); err != nil {
+		return nil, err
+	}
+	if entity.UpdatedAt, err = time.Parse(sqlTimeLayout, updatedAt); err != nil {
+		return nil, err
+	}
+	entity.Status = TodoStatus(status)
+
+	if completedAt.Valid {
+		if entity.CompletedAt, err = time.Parse(sqlTimeLayout, completedAt.String); err != nil {
+			return nil, err
+		}
+	}
+	if history.Valid {
+		if err := json.Unmarshal([]byte(history.String), &entity.History); err != nil {
+			return nil, err
+		}
+	}
+
+	return &entity, nil
+}
+
+// sqlTodos runs the todo operations on a database or inside a transaction.
+type sqlTodos struct {
+	conn       sqlConn
+	generateId GenerateId
+	clock      Clock
+	location   *time.Location
+	workflow   *Workflow
+}
+
+func (s *SQLStore) todos(conn sqlConn) sqlTodos {
+	return sqlTodos{conn: conn, generateId: s.GenerateId, clock: s.Clock, location: s.Location, workflow: s.Workflow.orDefault()}
+}
+
+func (s *SQLStore) workflow() *Workflow {
+	return s.Workflow.orDefault()
+}
+
+func (s *SQLStore) location() *time.Location {
+	return s.Location
+}
+
+func (s *SQLStore) audit(ctx context.Context, mutations []Mutation) {
+	if s.Audit != nil && len(mutations) > 0 {
+		s.Audit(ctx, mutations)
+	}
+}
+
+// inTx runs the write fn in its own transaction and commits it if fn
+// succeeds.
+func (s *SQLStore) inTx(ctx context.Context, op MutationOp, fn func(q sqlTodos) (*TodoEntity, error)) (*TodoEntity, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	entity, err := fn(s.todos(tx))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, []Mutation{{Op: op, Entity: *entity}})
+
+	return entity, nil
+}
+
+func (s *SQLStore) Insert(todo *Todo) (*TodoEntity, error) {
+	return s.InsertContext(context.Background(), todo)
+}
+
+func (s *SQLStore) InsertContext(ctx context.Context, todo *Todo) (*TodoEntity, error) {
+	return s.inTx(ctx, MutationInsert, func(q sqlTodos) (*TodoEntity, error) {
+		return q.insert(ctx, todo)
+	})
+}
+
+func (s *SQLStore) FetchAll() ([]TodoEntity, error) {
+	return s.FetchAllContext(context.Background())
+}
+
+func (s *SQLStore) FetchAllContext(ctx context.Context) ([]TodoEntity, error) {
+	return s.todos(s.DB).fetchAll(ctx)
+}
+
+func (s *SQLStore) FetchByQuery(query map[string]string) ([]TodoEntity, error) {
+	return s.FetchByQueryContext(context.Background(), query)
+}
+
+func (s *SQLStore) FetchByQueryContext(ctx context.Context, query map[string]string) ([]TodoEntity, error) {
+	return s.todos(s.DB).fetchByQuery(ctx, query)
+}
+
+func (s *SQLStore) FetchByFilter(query Query) ([]TodoEntity, error) {
+	return s.FetchByFilterContext(context.Background(), query)
+}
+
+func (s *SQLStore) FetchByFilterContext(ctx context.Context, query Query) ([]TodoEntity, error) {
+	return s.todos(s.DB).fetchByFilter(ctx, query)
+}
+
+func (s *SQLStore) IterAll(ctx context.Context) iter.Seq2[TodoEntity, error] {
+	return s.todos(s.DB).iterAll(ctx)
+}
+
+func (s *SQLStore) IterByQuery(ctx context.Context, query map[string]string) iter.Seq2[TodoEntity, error] {
+	return s.todos(s.DB).iterByQuery(ctx, query)
+}
+
+func (s *SQLStore) IterByFilter(ctx context.Context, query Query) iter.Seq2[TodoEntity, error] {
+	return s.todos(s.DB).iterByFilter(ctx, query)
+}
+
+func (s *SQLStore) Update(id string, model Todo) (*TodoEntity, error) {
+	return s.UpdateIfVersionContext(context.Background(), id, model, anyVersion)
+}
+
+func (s *SQLStore) UpdateContext(ctx context.Context, id string, model Todo) (*TodoEntity, error) {
+	return s.UpdateIfVersionContext(ctx, id, model, anyVersion)
+}
+
+func (s *SQLStore) UpdateIfVersion(id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	return s.UpdateIfVersionContext(context.Background(), id, model, expectedVersion)
+}
+
+func (s *SQLStore) UpdateIfVersionContext(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	return s.inTx(ctx, MutationUpdate, func(q sqlTodos) (*TodoEntity, error) {
+		return q.update(ctx, id, model, expectedVersion)
+	})
+}
+
+func (s *SQLStore) Delete(id string) (*TodoEntity, error) {
+	return s.DeleteIfVersionContext(context.Background(), id, anyVersion)
+}
+
+func (s *SQLStore) DeleteContext(ctx context.Context, id string) (*TodoEntity, error) {
+	return s.DeleteIfVersionContext(ctx, id, anyVersion)
+}
+
+func (s *SQLStore) DeleteIfVersion(id string, expectedVersion int64) (*TodoEntity, error) {
+	return s.DeleteIfVersionContext(context.Background(), id, expectedVersion)
+}
+
+func (s *SQLStore) DeleteIfVersionContext(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error) {
+	return s.inTx(ctx, MutationDelete, func(q sqlTodos) (*TodoEntity, error) {
+		return q.delete(ctx, id, expectedVersion)
+	})
+}
+
+func (s *SQLStore) Begin() (TodoTx, error) {
+	return s.BeginContext(context.Background())
+}
+
+// BeginContext starts a database transaction. Writers are serialized by
+// SQLite, so a commit never conflicts.
+func (s *SQLStore) BeginContext(ctx context.Context) (TodoTx, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlTx{ctx: ctx, store: s, tx: tx, todos: s.todos(tx)}, nil
+}
+
+func (q sqlTodos) insert(ctx context.Context, todo *Todo) (*TodoEntity, error) {
+	todoEntity, err := newTodoEntity(todo, q.generateId(), q.clock(), q.workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertSQLEntity(ctx, q.conn, todoEntity); err != nil {
+		return nil, err
+	}
+
+	return todoEntity, nil
+}
+
+func (q sqlTodos) fetchAll(ctx context.Context) ([]TodoEntity, error) {
+	return collectTodos(q.iterAll(ctx))
+}
+
+func (q sqlTodos) fetchByQuery(ctx context.Context, query map[string]string) ([]TodoEntity, error) {
+	return collectTodos(q.iterByQuery(ctx, query))
+}
+
+func (q sqlTodos) iterAll(ctx context.Context) iter.Seq2[TodoEntity, error] {
+	return q.iter(ctx, sqlSelectTodo+` ORDER BY rowid`, nil)
+}
+
+func (q sqlTodos) iterByQuery(ctx context.Context, query map[string]string) iter.Seq2[TodoEntity, error] {
+	compiled, err := compileQuery(query, q.workflow)
+	return q.iterQuery(ctx, compiled, err)
+}
+
+func (q sqlTodos) fetchByFilter(ctx context.Context, query Query) ([]TodoEntity, error) {
+	return collectTodos(q.iterByFilter(ctx, query))
+}
+
+func (q sqlTodos) iterByFilter(ctx context.Context, query Query) iter.Seq2[TodoEntity, error] {
+	if query.Workflow == nil {
+		query.Workflow = q.workflow
+	}
+
+	return q.iterQuery(ctx, query, typeCheckQuery(query))
+}
+
+// iterQuery streams the rows matching query, or yields queryErr, the
+// outcome of validating it.
+func (q sqlTodos) iterQuery(ctx context.Context, query Query, queryErr error) iter.Seq2[TodoEntity, error] {
+	if queryErr != nil {
+		return func(yield func(TodoEntity, error) bool) {
+			yield(TodoEntity{}, queryErr)
+		}
+	}
+
+	dc := query.dates(q.clock, q.location)
+	where, args := buildSQLFilter(query.Workflow.orDefault().expand(query.Filter), dc)
+
+	return q.iter(ctx, sqlSelectTodo+where+buildSQLOrder(query), args)
+}
+
+// iter streams the rows of query; the rows are closed when the loop ends.
+func (q sqlTodos) iter(ctx context.Context, query string, args []any) iter.Seq2[TodoEntity, error] {
+	return func(yield func(TodoEntity, error) bool) {
+		rows, err := q.conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(TodoEntity{}, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			entity, err := scanSQLEntity(rows)
+			if err != nil {
+				yield(TodoEntity{}, err)
+				return
+			}
+			if !yield(*entity, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(TodoEntity{}, err)
+		}
+	}
+}
+
+func (q sqlTodos) fetchById(ctx context.Context, id string) (*TodoEntity, error) {
+	entity, err := scanSQLEntity(q.conn.QueryRowContext(ctx, sqlSelectTodo+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &NotFoundError{Id: id}
+	}
+
+	return entity, err
+}
+
+func (q sqlTodos) update(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	if err := validateUpdate(model); err != nil {
+		return nil, err
+	}
+
+	current, err := q.fetchById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(current, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	entity, err := updateTodoEntity(*current, model, q.clock(), q.workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	completedAt, history, err := sqlCompletion(&entity)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.conn.ExecContext(
+		ctx,
+		`UPDATE todos SET updated_at = ?, version = ?, description = ?, status = ?, completed_at = ?, history = ? WHERE id = ?`,
+		entity.UpdatedAt.UTC().Format(sqlTimeLayout),
+		entity.Version,
+		entity.Description,
+		string(entity.Status),
+		completedAt,
+		history,
+		entity.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity, nil
+}
+
+func (q sqlTodos) delete(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error) {
+	entity, err := q.fetchById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(entity, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if _, err := q.conn.ExecContext(ctx, `DELETE FROM todos WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// sqlTx is a TodoTx backed by a database transaction. Its writes are
+// reported to the Audit hook of the store on Commit.
+type sqlTx struct {
+	ctx       context.Context
+	store     *SQLStore
+	tx        *sql.Tx
+	todos     sqlTodos
+	mutations []Mutation
+	done      bool
+}
+
+// record keeps a successful write so Commit can audit it.
+func (t *sqlTx) record(op MutationOp, entity *TodoEntity) {
+	t.mutations = append(t.mutations, Mutation{Op: op, Entity: *entity})
+}
+
+func (t *sqlTx) workflow() *Workflow {
+	return t.todos.workflow
+}
+
+func (t *sqlTx) location() *time.Location {
+	return t.todos.location
+}
+
+func (t *sqlTx) Insert(todo *Todo) (*TodoEntity, error) {
+	return t.InsertContext(t.ctx, todo)
+}
+
+func (t *sqlTx) InsertContext(ctx context.Context, todo *Todo) (*TodoEntity, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	entity, err := t.todos.insert(ctx, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	t.record(MutationInsert, entity)
+
+	return entity, nil
+}
+
+func (t *sqlTx) FetchAll() ([]TodoEntity, error) {
+	return t.FetchAllContext(t.ctx)
+}
+
+func (t *sqlTx) FetchAllContext(ctx context.Context) ([]TodoEntity, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	return t.todos.fetchAll(ctx)
+}
+
+func (t *sqlTx) FetchByQuery(query map[string]string) ([]TodoEntity, error) {
+	return t.FetchByQueryContext(t.ctx, query)
+}
+
+func (t *sqlTx) FetchByQueryContext(ctx context.Context, query map[string]string) ([]TodoEntity, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	return t.todos.fetchByQuery(ctx, query)
+}
+
+func (t *sqlTx) FetchByFilter(query Query) ([]TodoEntity, error) {
+	return t.FetchByFilterContext(t.ctx, query)
+}
+
+func (t *sqlTx) FetchByFilterContext(ctx context.Context, query Query) ([]TodoEntity, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	return t.todos.fetchByFilter(ctx, query)
+}
+
+func (t *sqlTx) IterAll(ctx context.Context) iter.Seq2[TodoEntity, error] {
+	return t.IterByQuery(ctx, map[string]string{})
+}
+
+func (t *sqlTx) IterByQuery(ctx context.Context, query map[string]string) iter.Seq2[TodoEntity, error] {
+	if t.done {
+		return func(yield func(TodoEntity, error) bool) {
+			yield(TodoEntity{}, ErrTxDone)
+		}
+	}
+	return t.todos.iterByQuery(ctx, query)
+}
+
+func (t *sqlTx) IterByFilter(ctx context.Context, query Query) iter.Seq2[TodoEntity, error] {
+	if t.done {
+		return func(yield func(TodoEntity, error) bool) {
+			yield(TodoEntity{}, ErrTxDone)
+		}
+	}
+	return t.todos.iterByFilter(ctx, query)
+}
+
+func (t *sqlTx) Update(id string, model Todo) (*TodoEntity, error) {
+	return t.UpdateIfVersionContext(t.ctx, id, model, anyVersion)
+}
+
+func (t *sqlTx) UpdateContext(ctx context.Context, id string, model Todo) (*TodoEntity, error) {
+	return t.UpdateIfVersionContext(ctx, id, model, anyVersion)
+}
+
+func (t *sqlTx) UpdateIfVersion(id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	return t.UpdateIfVersionContext(t.ctx, id, model, expectedVersion)
+}
+
+func (t *sqlTx) UpdateIfVersionContext(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	entity, err := t.todos.update(ctx, id, model, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	t.record(MutationUpdate, entity)
+
+	return entity, nil
+}
+
+func (t *sqlTx) Delete(id string) (*TodoEntity, error) {
+	return t.DeleteIfVersionContext(t.ctx, id, anyVersion)
+}
+
+func (t *sqlTx) DeleteContext(ctx context.Context, id string) (*TodoEntity, error) {
+	return t.DeleteIfVersionContext(ctx, id, anyVersion)
+}
+
+func (t *sqlTx) DeleteIfVersion(id string, expectedVersion int64) (*TodoEntity, error) {
+	return t.DeleteIfVersionContext(t.ctx, id, expectedVersion)
+}
+
+func (t *sqlTx) DeleteIfVersionContext(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	entity, err := t.todos.delete(ctx, id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	t.record(MutationDelete, entity)
+
+	return entity, nil
+}
+
+func (t *sqlTx) Commit() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+
+	t.store.audit(t.ctx, t.mutations)
+
+	return nil
+}
+
+func (t *sqlTx) Rollback() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+
+	return t.tx.Rollback()
+}
+
+// buildSQLFilter translates a type-checked filter tree into a WHERE clause.
+// Values are always passed as parameters. Time values are resolved with dc
+// into UTC bounds, which compare with the stored timestamps as strings.
+func buildSQLFilter(filter Filter, dc dateContext) (string, []any) {
+	args := make([]any, 0)
+	if filter == nil {
+		return "", args
+	}
+
+	condition, args := buildSQLCondition(filter, dc, args)
+
+	return " WHERE " + condition, args
+}
+
+func buildSQLCondition(filter Filter, dc dateContext, args []any) (string, []any) {
+	switch f := filter.(type) {
+	case AndFilter:
+		return joinSQLConditions(f.Filters, " AND ", "1 = 1", dc, args)
+	case OrFilter:
+		return joinSQLConditions(f.Filters, " OR ", "1 = 0", dc, args)
+	case NotFilter:
+		condition, args := buildSQLCondition(f.Filter, dc, args)
+		return "NOT (" + condition + ")", args
+	case FieldFilter:
+		column := sqlColumns[f.Field]
+
+		switch f.Field {
+		case "CreatedAt", "UpdatedAt":
+			span, _ := filterSpan(f.Op, f.Value, dc)
+
+			from, to := span.from.UTC().Format(sqlTimeLayout), span.to.UTC().Format(sqlTimeLayout)
+
+			switch {
+			case span.hasFrom && span.hasTo:
+				return fmt.Sprintf("(%v >= ? AND %v < ?)", column, column), append(args, from, to)
+			case span.hasFrom:
+				return column + " >= ?", append(args, from)
+			default:
+				return column + " < ?", append(args, to)
+			}
+		case "Description":
+			switch f.Op {
+			case OpContains:
+				return fmt.Sprintf("instr(%v, ?) > 0", column), append(args, f.Value)
+			case OpPrefix:
+				return fmt.Sprintf("instr(%v, ?) = 1", column), append(args, f.Value)
+			case OpEqualFold, OpRegex:
+				return fmt.Sprintf("todo_match(%v, ?, ?)", column), append(args, string(f.Op), f.Value)
+			}
+		}
+
+		return column + " = ?", append(args, f.Value)
+	}
+
+	return "1 = 1", args
+}
+
+// joinSQLConditions joins the conditions of filters with op, wrapping the
+// nested ones in parentheses. empty is the condition of no filters.
+func joinSQLConditions(filters []Filter, op string, empty string, dc dateContext, args []any) (string, []any) {
+	if len(filters) == 0 {
+		return empty, args
+	}
+
+	conditions := make([]string, 0, len(filters))
+	for _, child := range filters {
+		var condition string
+		condition, args = buildSQLCondition(child, dc, args)
+
+		switch child.(type) {
+		case AndFilter, OrFilter:
+			condition = "(" + condition + ")"
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return strings.Join(conditions, op), args
+}
+
+// buildSQLOrder translates SortBy/Sort into an ORDER BY clause. Rows tied
+// on every key keep their insertion order, like sortQuery does.
+func buildSQLOrder(query Query) string {
+	keys := query.sortKeys()
+
+	terms := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		direction := "ASC"
+		if key.desc {
+			direction = "DESC"
+		}
+		terms = append(terms, sqlColumns[key.field]+" "+direction)
+	}
+
+	return " ORDER BY " + strings.Join(append(terms, "rowid"), ", ")
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTestSQLStore(t *testing.T, generateId GenerateId, clock Clock) *SQLStore {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "todos.db"), generateId, clock)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	return store
+}
+
+func TestSQLStoreConformance(t *testing.T) {
+	testTodoStore(t, func(t *testing.T, generateId GenerateId, clock Clock, seed []TodoEntity) TodoStore {
+		store := openTestSQLStore(t, generateId, clock)
+		for i := range seed {
+			if err := insertSQLEntity(context.Background(), store.DB, &seed[i]); err != nil {
+				t.Fatalf("insertSQLEntity() error %v", err)
+			}
+		}
+
+		return store
+	})
+}
+
+func TestSQLStoreQueryParameters(t *testing.T) {
+	store := openTestSQLStore(t, sequenceId(), fixedClock)
+	if _, err := store.Insert(&Todo{Description: "Safe"}); err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+
+	got, err := store.FetchByQuery(map[string]string{"Description": "x' OR '1'='1"})
+	if err != nil {
+		t.Fatalf("FetchByQuery() error %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("FetchByQuery() = %v, want no matches", got)
+	}
+
+	where, args := buildSQLFilter(queryFromMap(map[string]string{
+		"Status":       "Done",
+		"CreatedAt_lt": "2024-11-10",
+		"SortBy":       "Id",
+		"Sort":         "asc",
+	}).Filter, dateContext{loc: time.UTC})
+	wantWhere := " WHERE created_at < ? AND status = ?"
+	if where != wantWhere {
+		t.Errorf("buildSQLFilter() of a query map = %q, want %q", where, wantWhere)
+	}
+	if !reflect.DeepEqual(args, []any{"2024-11-10T00:00:00.000000000Z", "Done"}) {
+		t.Errorf("buildSQLFilter() of a query map args = %v", args)
+	}
+
+	where, args = buildSQLFilter(Or(Eq("Id", "1"), Not(And(Eq("Status", "Done"), Contains("Description", "%")))), dateContext{loc: time.UTC})
+	wantWhere = " WHERE id = ? OR NOT (status = ? AND instr(description, ?) > 0)"
+	if where != wantWhere {
+		t.Errorf("buildSQLFilter() = %q, want %q", where, wantWhere)
+	}
+	if !reflect.DeepEqual(args, []any{"1", "Done", "%"}) {
+		t.Errorf("buildSQLFilter() args = %v", args)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.db")
+
+	store, err := OpenSQLiteStore(path, sequenceId(), fixedClock)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error %v", err)
+	}
+	inserted, err := store.Insert(&Todo{Description: "Keep me"})
+	if err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+	store.Close()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	next := append(slices.Clone(sqlMigrations), migration{
+		Version:    len(sqlMigrations) + 1,
+		Statements: []string{`ALTER TABLE todos ADD COLUMN due_at TEXT`},
+	})
+
+	// Running twice must only apply the new migration once.
+	for i := 0; i < 2; i++ {
+		if err := migrate(db, next); err != nil {
+			t.Fatalf("migrate() error %v", err)
+		}
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(next) {
+		t.Errorf("schema version = %v, want %v", version, len(next))
+	}
+
+	migrated := &SQLStore{DB: db, GenerateId: sequenceId(), Clock: fixedClock}
+	got, err := migrated.FetchAll()
+	if err != nil {
+		t.Fatalf("FetchAll() error %v", err)
+	}
+	if !reflect.DeepEqual(got, []TodoEntity{*inserted}) {
+		t.Errorf("FetchAll() after migration = %v, want %v", got, []TodoEntity{*inserted})
+	}
+
+	failing := append(slices.Clone(next), migration{
+		Version:    len(next) + 1,
+		Statements: []string{`ALTER TABLE todos ADD COLUMN tags TEXT`, `NOT SQL`},
+	})
+	if err := migrate(db, failing); err == nil {
+		t.Fatalf("migrate() expected an error")
+	}
+
+	// The failed migration is rolled back as a whole.
+	if _, err := db.Exec(`ALTER TABLE todos ADD COLUMN tags TEXT`); err != nil {
+		t.Errorf("failed migration left partial changes: %v", err)
+	}
+}
+
+func TestOpenSQLiteStorePath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "to?do#1%20")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenSQLiteStore(filepath.Join(dir, "todos.db"), sequenceId(), fixedClock)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Insert(&Todo{Description: "Escaped"}); err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "todos.db")); err != nil {
+		t.Errorf("database not created at the given path: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"iter"
+)
+
+// TodoOperations are the reads and writes shared by a TodoStore and the
+// transactions it starts.
+type TodoOperations interface {
+	Insert(todo *Todo) (*TodoEntity, error)
+	FetchAll() ([]TodoEntity, error)
+	FetchByQuery(query map[string]string) ([]TodoEntity, error)
+	// FetchByFilter is FetchByQuery for a filter tree, which can express
+	// OR and NOT. Type errors are *InvalidQueryError with the Path of the
+	// invalid node.
+	FetchByFilter(query Query) ([]TodoEntity, error)
+	Update(id string, model Todo) (*TodoEntity, error)
+	Delete(id string) (*TodoEntity, error)
+	// UpdateIfVersion and DeleteIfVersion fail with a *VersionConflictError
+	// when the entity is no longer at expectedVersion.
+	UpdateIfVersion(id string, model Todo, expectedVersion int64) (*TodoEntity, error)
+	DeleteIfVersion(id string, expectedVersion int64) (*TodoEntity, error)
+
+	// The Context variants stop with ctx.Err() once ctx is done, and hand
+	// ctx to the Audit hook of the store.
+	InsertContext(ctx context.Context, todo *Todo) (*TodoEntity, error)
+	FetchAllContext(ctx context.Context) ([]TodoEntity, error)
+	FetchByQueryContext(ctx context.Context, query map[string]string) ([]TodoEntity, error)
+	FetchByFilterContext(ctx context.Context, query Query) ([]TodoEntity, error)
+	UpdateContext(ctx context.Context, id string, model Todo) (*TodoEntity, error)
+	DeleteContext(ctx context.Context, id string) (*TodoEntity, error)
+	UpdateIfVersionContext(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error)
+	DeleteIfVersionContext(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error)
+
+	// IterAll, IterByQuery and IterByFilter stream todos lazily; breaking
+	// out of the loop stops the scan. An error is yielded once, as the last
+	// value.
+	IterAll(ctx context.Context) iter.Seq2[TodoEntity, error]
+	IterByQuery(ctx context.Context, query map[string]string) iter.Seq2[TodoEntity, error]
+	IterByFilter(ctx context.Context, query Query) iter.Seq2[TodoEntity, error]
+}
+
+// TodoStore is the set of operations every todo backend must provide.
+// TodoRepository is the in-memory, slice-backed implementation.
+type TodoStore interface {
+	TodoOperations
+	Begin() (TodoTx, error)
+	// BeginContext starts a transaction bound to ctx. If ctx is done before
+	// Commit, the commit fails and nothing is written.
+	BeginContext(ctx context.Context) (TodoTx, error)
+}
+
+// TodoTx stages writes until Commit applies them all at once. Reads made
+// through the transaction see its own uncommitted writes. A TodoTx is not
+// safe for concurrent use.
+type TodoTx interface {
+	TodoOperations
+	Commit() error
+	Rollback() error
+}
+
+var _ TodoStore = (*TodoRepository)(nil)
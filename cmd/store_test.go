@@ -0,0 +1,1803 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStoreFunc builds a fresh backend seeded with the given entities.
+type newStoreFunc func(t *testing.T, generateId GenerateId, clock Clock, seed []TodoEntity) TodoStore
+
+func fixedClock() time.Time {
+	return time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC)
+}
+
+func fixedId() string {
+	return "123"
+}
+
+func sequenceId() GenerateId {
+	next := 0
+	return func() string {
+		next++
+		return strconv.Itoa(next)
+	}
+}
+
+func conformanceSeed() []TodoEntity {
+	return []TodoEntity{
+		{
+			Entity{
+				Id:        "1234",
+				CreatedAt: time.Date(2024, 11, 11, 0, 0, 0, 0, time.UTC),
+				Version:   1,
+			},
+			Todo{
+				Description: "Description 1234",
+				Status:      StatusDone,
+			},
+		},
+		{
+			Entity{
+				Id:        "1235",
+				CreatedAt: time.Date(2024, 11, 9, 0, 0, 0, 0, time.UTC),
+				Version:   1,
+			},
+			Todo{
+				Description: "Description 1235",
+				Status:      StatusNotDone,
+			},
+		},
+	}
+}
+
+// testTodoStore is the conformance suite every TodoStore backend must pass.
+func testTodoStore(t *testing.T, newStore newStoreFunc) {
+	t.Run("Insert", func(t *testing.T) {
+		testStoreInsert(t, newStore)
+	})
+	t.Run("FetchAll", func(t *testing.T) {
+		testStoreFetchAll(t, newStore)
+	})
+	t.Run("FetchByQuery", func(t *testing.T) {
+		testStoreFetchByQuery(t, newStore)
+	})
+	t.Run("FetchByFilter", func(t *testing.T) {
+		testStoreFetchByFilter(t, newStore)
+	})
+	t.Run("QueryText", func(t *testing.T) {
+		testStoreQueryText(t, newStore)
+	})
+	t.Run("TimeFilters", func(t *testing.T) {
+		testStoreTimeFilters(t, newStore)
+	})
+	t.Run("Sorting", func(t *testing.T) {
+		testStoreSorting(t, newStore)
+	})
+	t.Run("Pagination", func(t *testing.T) {
+		testStorePagination(t, newStore)
+	})
+	t.Run("Aggregate", func(t *testing.T) {
+		testStoreAggregate(t, newStore)
+	})
+	t.Run("Records", func(t *testing.T) {
+		testStoreRecords(t, newStore)
+	})
+	t.Run("Bulk", func(t *testing.T) {
+		testStoreBulk(t, newStore)
+	})
+	t.Run("Workflow", func(t *testing.T) {
+		testStoreWorkflow(t, newStore)
+	})
+	t.Run("History", func(t *testing.T) {
+		testStoreHistory(t, newStore)
+	})
+	t.Run("Patch", func(t *testing.T) {
+		testStorePatch(t, newStore)
+	})
+	t.Run("Update", func(t *testing.T) {
+		testStoreUpdate(t, newStore)
+	})
+	t.Run("Delete", func(t *testing.T) {
+		testStoreDelete(t, newStore)
+	})
+	t.Run("ConditionalWrites", func(t *testing.T) {
+		testStoreConditionalWrites(t, newStore)
+	})
+	t.Run("Iterators", func(t *testing.T) {
+		testStoreIterators(t, newStore)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		testStoreErrors(t, newStore)
+	})
+	t.Run("Transactions", func(t *testing.T) {
+		testStoreTransactions(t, newStore)
+	})
+	t.Run("Cancellation", func(t *testing.T) {
+		testStoreCancellation(t, newStore)
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		testStoreConcurrency(t, newStore)
+	})
+}
+
+func testStoreInsert(t *testing.T, newStore newStoreFunc) {
+	tests := []struct {
+		todo    *Todo
+		want    *TodoEntity
+		name    string
+		wantErr bool
+	}{
+		{
+			name: "Insert a Todo with status",
+			todo: &Todo{
+				Description: "Todo Description",
+				Status:      StatusDone,
+			},
+			want: &TodoEntity{
+				Entity{
+					Id:          "123",
+					CreatedAt:   fixedClock(),
+					UpdatedAt:   fixedClock(),
+					Version:     1,
+					CompletedAt: fixedClock(),
+					History:     []StatusChange{{To: StatusDone, At: fixedClock()}},
+				},
+				Todo{
+					Description: "Todo Description",
+					Status:      StatusDone,
+				},
+			},
+		},
+		{
+			name: "Insert a Todo without status",
+			todo: &Todo{
+				Description: "No Status",
+			},
+			want: &TodoEntity{
+				Entity{
+					Id:        "123",
+					CreatedAt: fixedClock(),
+					UpdatedAt: fixedClock(),
+					Version:   1,
+					History:   []StatusChange{{To: StatusNotDone, At: fixedClock()}},
+				},
+				Todo{
+					Description: "No Status",
+					Status:      StatusNotDone,
+				},
+			},
+		},
+		{
+			name:    "Insert a Todo without Description",
+			todo:    &Todo{},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, nil)
+
+			got, err := store.Insert(tc.todo)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Insert() error %v, wantsErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Insert() = %v, want %v", got, tc.want)
+			}
+
+			all, err := store.FetchAll()
+			if err != nil {
+				t.Fatalf("FetchAll() error %v", err)
+			}
+			if !reflect.DeepEqual(all, []TodoEntity{*tc.want}) {
+				t.Errorf("FetchAll() after Insert = %v, want %v", all, []TodoEntity{*tc.want})
+			}
+		})
+	}
+}
+
+func testStoreFetchAll(t *testing.T, newStore newStoreFunc) {
+	store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+	got, err := store.FetchAll()
+	if err != nil {
+		t.Fatalf("FetchAll() error %v", err)
+	}
+
+	if !reflect.DeepEqual(got, conformanceSeed()) {
+		t.Errorf("FetchAll() = %v, want %v", got, conformanceSeed())
+	}
+}
+
+func testStoreFetchByQuery(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+
+	tests := []struct {
+		query   map[string]string
+		name    string
+		want    []TodoEntity
+		wantErr bool
+	}{
+		{
+			name:  "Fetch by query id",
+			query: map[string]string{"Id": "1234"},
+			want:  []TodoEntity{seed[0]},
+		},
+		{
+			name:  "Fetch by query status done",
+			query: map[string]string{"Status": "Done"},
+			want:  []TodoEntity{seed[0]},
+		},
+		{
+			name:  "Fetch by query createdAt less than 2024-11-10",
+			query: map[string]string{"CreatedAt_lt": "2024-11-10"},
+			want:  []TodoEntity{seed[1]},
+		},
+		{
+			name:  "Fetch by query createdAt greater than 2024-11-10",
+			query: map[string]string{"CreatedAt_gt": "2024-11-10"},
+			want:  []TodoEntity{seed[0]},
+		},
+		{
+			name:  "Fetch by query sort by CreatedAt in ascending order",
+			query: map[string]string{"SortBy": "CreatedAt", "Sort": "asc"},
+			want:  []TodoEntity{seed[1], seed[0]},
+		},
+		{
+			name:  "Fetch by query sort by CreatedAt in descending order",
+			query: map[string]string{"SortBy": "CreatedAt", "Sort": "desc"},
+			want:  []TodoEntity{seed[0], seed[1]},
+		},
+		{
+			name:  "Fetch by query description fragment",
+			query: map[string]string{"Description_contains": "ion 123", "Description_prefix": "Desc", "Description_ieq": "description 1235"},
+			want:  []TodoEntity{seed[1]},
+		},
+		{
+			name:  "Fetch by query description regex",
+			query: map[string]string{"Description_regex": "12(34|99)$"},
+			want:  []TodoEntity{seed[0]},
+		},
+		{
+			name:    "Fetch by query with an invalid regex",
+			query:   map[string]string{"Description_regex": "[a-"},
+			wantErr: true,
+		},
+		{
+			name:    "Fetch by query with an operator the field lacks",
+			query:   map[string]string{"Status_prefix": "Do"},
+			wantErr: true,
+		},
+		{
+			name:  "Fetch by query without matches",
+			query: map[string]string{"Id": "9999"},
+			want:  []TodoEntity{},
+		},
+		{
+			name:    "Fetch by query with an invalid field",
+			query:   map[string]string{"Priority": "high"},
+			wantErr: true,
+		},
+		{
+			name:    "Fetch by query with an invalid status",
+			query:   map[string]string{"Status": "Maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "Fetch by query with a sort but no sort by",
+			query:   map[string]string{"Sort": "asc"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+			got, err := store.FetchByQuery(tc.query)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("FetchByQuery() error %v, wantsErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FetchByQuery() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func testStoreFetchByFilter(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+
+	tests := []struct {
+		query    Query
+		name     string
+		want     []TodoEntity
+		wantPath string
+	}{
+		{
+			name:  "No filter",
+			query: Query{},
+			want:  seed,
+		},
+		{
+			name:  "Or of field predicates",
+			query: Query{Filter: Or(Eq("Status", "Done"), Lt("CreatedAt", "2024-11-10")), SortBy: "Id", Sort: "desc"},
+			want:  []TodoEntity{seed[1], seed[0]},
+		},
+		{
+			name:  "Not",
+			query: Query{Filter: Not(Eq("Id", "1234"))},
+			want:  []TodoEntity{seed[1]},
+		},
+		{
+			name:  "Grouped predicates",
+			query: Query{Filter: And(Contains("Description", "123"), Or(Gt("CreatedAt", "2024-11-10"), Eq("Status", "NotDone")), Not(Eq("Id", "1235")))},
+			want:  []TodoEntity{seed[0]},
+		},
+		{
+			name:  "Description prefix",
+			query: Query{Filter: Prefix("Description", "Description 123")},
+			want:  seed,
+		},
+		{
+			name:  "Description ignoring case",
+			query: Query{Filter: EqualFold("Description", "dESCRIPTION 1235")},
+			want:  []TodoEntity{seed[1]},
+		},
+		{
+			name:  "Description regex",
+			query: Query{Filter: Regex("Description", `^Desc\w+ \d+4$`)},
+			want:  []TodoEntity{seed[0]},
+		},
+		{
+			name:  "Empty or matches nothing",
+			query: Query{Filter: Or()},
+			want:  []TodoEntity{},
+		},
+		{
+			name:     "Invalid value",
+			query:    Query{Filter: And(Eq("Id", "1234"), Or(Eq("Status", "Done"), Gt("UpdatedAt", "soon")))},
+			wantPath: "Filter.And[1].Or[1]",
+		},
+		{
+			name:     "Invalid regex",
+			query:    Query{Filter: Or(Eq("Id", "1"), Regex("Description", "deploy("))},
+			wantPath: "Filter.Or[1]",
+		},
+		{
+			name:     "Invalid operator",
+			query:    Query{Filter: Not(Lt("Status", "Done"))},
+			wantPath: "Filter.Not",
+		},
+		{
+			name:     "Missing node",
+			query:    Query{Filter: And(Eq("Id", "1234"), nil)},
+			wantPath: "Filter.And[1]",
+		},
+		{
+			name:     "Pointer node",
+			query:    Query{Filter: Or(&FieldFilter{Field: "Id", Op: OpEq, Value: "1234"})},
+			wantPath: "Filter.Or[0]",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+			got, err := store.FetchByFilter(tc.query)
+			if tc.wantPath != "" {
+				var invalid *InvalidQueryError
+				if !errors.As(err, &invalid) || invalid.Path != tc.wantPath {
+					t.Fatalf("FetchByFilter() error %v, want a *InvalidQueryError at %v", err, tc.wantPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchByFilter() error %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FetchByFilter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func testStoreQueryText(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+
+	tests := []struct {
+		text string
+		want []TodoEntity
+	}{
+		{text: "", want: seed},
+		{text: "status:Done", want: []TodoEntity{seed[0]}},
+		{text: "created<2024-11-10 sort:-created", want: []TodoEntity{seed[1]}},
+		{text: "status:Done or id:1235 sort:-id", want: []TodoEntity{seed[1], seed[0]}},
+		{text: "not status:Done", want: []TodoEntity{seed[1]}},
+		{text: `description~"1235" and (created>2024-11-10 or status:notdone)`, want: []TodoEntity{seed[1]}},
+		{text: "created>2024-11-10 and created<2024-11-10", want: []TodoEntity{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+			got, err := FetchByQueryText(context.Background(), store, tc.text)
+			if err != nil {
+				t.Fatalf("FetchByQueryText() error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FetchByQueryText() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func testStoreTimeFilters(t *testing.T, newStore newStoreFunc) {
+	// 23:30 on November 9 three hours west of UTC is already November 10 in
+	// UTC. The fixed clock is 21:00 on November 9 there.
+	local := time.FixedZone("UTC-3", -3*60*60)
+	at := func(value string) TodoEntity {
+		created, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return TodoEntity{
+			Entity: Entity{Id: value, CreatedAt: created.UTC(), UpdatedAt: created.UTC(), Version: 1},
+			Todo:   Todo{Description: "Created " + value, Status: StatusNotDone},
+		}
+	}
+	lateNight := at("2024-11-09T23:30:00-03:00")
+	morning := at("2024-11-09T09:00:00-03:00")
+	nextDay := at("2024-11-10T09:00:00-03:00")
+	lastWeek := at("2024-11-03T09:00:00-03:00")
+	seed := []TodoEntity{lateNight, morning, nextDay, lastWeek}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []TodoEntity
+	}{
+		{
+			name:  "Day in UTC",
+			query: Query{Filter: Eq("CreatedAt", "2024-11-09")},
+			want:  []TodoEntity{morning},
+		},
+		{
+			name:  "Day in a location",
+			query: Query{Filter: Eq("CreatedAt", "2024-11-09"), Location: local},
+			want:  []TodoEntity{lateNight, morning},
+		},
+		{
+			name:  "Today in a location",
+			query: Query{Filter: Eq("CreatedAt", "today"), Location: local},
+			want:  []TodoEntity{lateNight, morning},
+		},
+		{
+			name:  "Today with an explicit now",
+			query: Query{Filter: Eq("CreatedAt", "today"), Location: local, Now: nextDay.CreatedAt},
+			want:  []TodoEntity{nextDay},
+		},
+		{
+			name:  "Before the day",
+			query: Query{Filter: Lt("CreatedAt", "2024-11-10"), Location: local},
+			want:  []TodoEntity{lateNight, morning, lastWeek},
+		},
+		{
+			name:  "After the day",
+			query: Query{Filter: Gt("CreatedAt", "2024-11-09"), Location: local},
+			want:  []TodoEntity{nextDay},
+		},
+		{
+			name:  "From a timestamp",
+			query: Query{Filter: Gte("CreatedAt", "2024-11-09T23:30:00-03:00")},
+			want:  []TodoEntity{lateNight, nextDay},
+		},
+		{
+			name:  "After a timestamp",
+			query: Query{Filter: Gt("UpdatedAt", "2024-11-10T02:30:00Z")},
+			want:  []TodoEntity{nextDay},
+		},
+		{
+			name:  "Up to a timestamp",
+			query: Query{Filter: Lte("CreatedAt", "2024-11-09T23:30:00-03:00")},
+			want:  []TodoEntity{lateNight, morning, lastWeek},
+		},
+		{
+			name:  "Relative range",
+			query: Query{Filter: Between("CreatedAt", "-7d", "yesterday"), Location: local},
+			want:  []TodoEntity{lastWeek},
+		},
+		{
+			name:  "Last hours",
+			query: Query{Filter: And(Gte("CreatedAt", "-12h"), Lt("CreatedAt", "now"))},
+			want:  []TodoEntity{morning},
+		},
+		{
+			name:  "Not in a range",
+			query: Query{Filter: Not(Between("CreatedAt", "2024-11-09", "2024-11-10")), Location: local},
+			want:  []TodoEntity{lastWeek},
+		},
+		{
+			name:  "Sort by exact time in any location",
+			query: Query{SortBy: "CreatedAt", Sort: "asc", Location: local},
+			want:  []TodoEntity{lastWeek, morning, lateNight, nextDay},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, seed)
+
+			got, err := store.FetchByFilter(tc.query)
+			if err != nil {
+				t.Fatalf("FetchByFilter() error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FetchByFilter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	store := newStore(t, fixedId, fixedClock, seed)
+	got, err := store.FetchByQuery(map[string]string{"CreatedAt_gte": "2024-11-09", "CreatedAt_lte": "2024-11-09"})
+	if err != nil {
+		t.Fatalf("FetchByQuery() error %v", err)
+	}
+	if !reflect.DeepEqual(got, []TodoEntity{morning}) {
+		t.Errorf("FetchByQuery() = %v, want %v", got, []TodoEntity{morning})
+	}
+}
+
+func testStoreSorting(t *testing.T, newStore newStoreFunc) {
+	todo := func(id string, status TodoStatus, created time.Time, updated time.Time) TodoEntity {
+		return TodoEntity{
+			Entity: Entity{Id: id, CreatedAt: created, UpdatedAt: updated, Version: 1},
+			Todo:   Todo{Description: "Same description", Status: status},
+		}
+	}
+	morning := time.Date(2024, 11, 10, 9, 0, 0, 0, time.UTC)
+	evening := time.Date(2024, 11, 10, 21, 0, 0, 0, time.UTC)
+	// Every todo is created on the same day; c and d share their timestamps.
+	a := todo("a", StatusDone, evening, evening)
+	b := todo("b", StatusNotDone, morning, evening)
+	c := todo("c", StatusNotDone, morning, morning)
+	d := todo("d", StatusNotDone, morning, morning)
+	e := todo("e", StatusDone, morning, morning)
+	seed := []TodoEntity{d, a, c, e, b}
+
+	tests := []struct {
+		name  string
+		query map[string]string
+		want  []TodoEntity
+	}{
+		{
+			name:  "Exact timestamps",
+			query: map[string]string{"SortBy": "CreatedAt", "Sort": "desc"},
+			want:  []TodoEntity{a, d, c, e, b},
+		},
+		{
+			name:  "Ties keep their order",
+			query: map[string]string{"SortBy": "Description", "Sort": "asc"},
+			want:  seed,
+		},
+		{
+			name:  "Several keys with their own direction",
+			query: map[string]string{"SortBy": "Status,UpdatedAt,Id", "Sort": "asc,desc,asc"},
+			want:  []TodoEntity{a, e, b, c, d},
+		},
+		{
+			name:  "Several keys with one direction",
+			query: map[string]string{"SortBy": "UpdatedAt,Id", "Sort": "desc"},
+			want:  []TodoEntity{b, a, e, d, c},
+		},
+		{
+			name:  "Filtered",
+			query: map[string]string{"Status": "NotDone", "SortBy": "UpdatedAt,CreatedAt", "Sort": "asc"},
+			want:  []TodoEntity{d, c, b},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, seed)
+
+			got, err := store.FetchByQuery(tc.query)
+			if err != nil {
+				t.Fatalf("FetchByQuery() error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FetchByQuery() = %v, want %v", ids(got), ids(tc.want))
+			}
+		})
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+		query := Query{SortBy: "Status,CreatedAt", Sort: "desc,asc"}
+
+		var got []TodoEntity
+		cursor := ""
+		for {
+			page, err := FetchPage(context.Background(), store, query, 2, cursor)
+			if err != nil {
+				t.Fatalf("FetchPage() error %v", err)
+			}
+			got = append(got, page.Todos...)
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+		if want := []TodoEntity{b, c, d, e, a}; !reflect.DeepEqual(got, want) {
+			t.Errorf("FetchPage() pages = %v, want %v", ids(got), ids(want))
+		}
+	})
+
+	invalid := []map[string]string{
+		{"SortBy": "Id,Priority", "Sort": "asc"},
+		{"SortBy": "Id,Id", "Sort": "asc"},
+		{"SortBy": "Status,Id", "Sort": "asc,desc,asc"},
+		{"SortBy": "Status,Id", "Sort": "asc,up"},
+		{"SortBy": "Status,", "Sort": "asc"},
+	}
+	store := newStore(t, fixedId, fixedClock, seed)
+	for _, query := range invalid {
+		if _, err := store.FetchByQuery(query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("FetchByQuery(%v) error %v, want ErrInvalidQuery", query, err)
+		}
+	}
+}
+
+func ids(todos []TodoEntity) []string {
+	result := make([]string, 0, len(todos))
+	for _, t := range todos {
+		result = append(result, t.Id)
+	}
+
+	return result
+}
+
+// setStoreLocation sets the Location of a store built by a newStoreFunc.
+func setStoreLocation(t *testing.T, store TodoStore, loc *time.Location) {
+	t.Helper()
+
+	switch s := store.(type) {
+	case *TodoRepository:
+		s.Location = loc
+	case *FileStore:
+		s.Location = loc
+	case *LogStore:
+		s.Location = loc
+	case *SQLStore:
+		s.Location = loc
+	default:
+		t.Fatalf("Cannot set the Location of a %T", store)
+	}
+}
+
+func testStoreAggregate(t *testing.T, newStore newStoreFunc) {
+	todo := func(id string, status TodoStatus, created time.Time, updated time.Time) TodoEntity {
+		return TodoEntity{
+			Entity: Entity{Id: id, CreatedAt: created, UpdatedAt: updated, Version: 1},
+			Todo:   Todo{Description: "Todo " + id, Status: status},
+		}
+	}
+	date := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(2024, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	seed := []TodoEntity{
+		todo("a", StatusDone, date(10, 30, 8), date(10, 30, 12)),
+		todo("b", StatusDone, date(11, 2, 8), date(11, 3, 8)),
+		todo("c", StatusNotDone, date(11, 4, 8), date(11, 4, 8)),
+		todo("d", StatusNotDone, date(11, 5, 1), date(11, 6, 1)),
+	}
+
+	tests := []struct {
+		// storeLocation, when set, is the Location of the store.
+		storeLocation *time.Location
+		name          string
+		query         Query
+		by            []GroupBy
+		want          []Bucket
+	}{
+		{
+			name: "Everything",
+			want: []Bucket{{Key: []string{}, Count: 4, Oldest: date(10, 30, 8), Newest: date(11, 5, 1), Completed: 2, AverageCompletion: 14 * time.Hour}},
+		},
+		{
+			name: "By status",
+			by:   []GroupBy{GroupByStatus},
+			want: []Bucket{
+				{Key: []string{"Done"}, Count: 2, Oldest: date(10, 30, 8), Newest: date(11, 2, 8), Completed: 2, AverageCompletion: 14 * time.Hour},
+				{Key: []string{"NotDone"}, Count: 2, Oldest: date(11, 4, 8), Newest: date(11, 5, 1)},
+			},
+		},
+		{
+			name: "By week and status",
+			by:   []GroupBy{GroupByCreatedWeek, GroupByStatus},
+			want: []Bucket{
+				{Key: []string{"2024-10-28", "Done"}, Count: 2, Oldest: date(10, 30, 8), Newest: date(11, 2, 8), Completed: 2, AverageCompletion: 14 * time.Hour},
+				{Key: []string{"2024-11-04", "NotDone"}, Count: 2, Oldest: date(11, 4, 8), Newest: date(11, 5, 1)},
+			},
+		},
+		{
+			name:  "Filtered by month in a location",
+			query: Query{Filter: Gte("CreatedAt", "2024-11-01"), Location: time.FixedZone("UTC-3", -3*60*60)},
+			by:    []GroupBy{GroupByCreatedMonth},
+			want: []Bucket{
+				{Key: []string{"2024-11-01"}, Count: 3, Oldest: date(11, 2, 8), Newest: date(11, 5, 1), Completed: 1, AverageCompletion: 24 * time.Hour},
+			},
+		},
+		{
+			name:  "By day in a location",
+			query: Query{Filter: Eq("Status", "NotDone"), Location: time.FixedZone("UTC-3", -3*60*60)},
+			by:    []GroupBy{GroupByCreatedDay},
+			want: []Bucket{
+				{Key: []string{"2024-11-04"}, Count: 2, Oldest: date(11, 4, 8), Newest: date(11, 5, 1)},
+			},
+		},
+		{
+			name:          "By day in the location of the store",
+			storeLocation: time.FixedZone("UTC-3", -3*60*60),
+			query:         Query{Filter: Eq("CreatedAt", "2024-11-04")},
+			by:            []GroupBy{GroupByCreatedDay},
+			want: []Bucket{
+				{Key: []string{"2024-11-04"}, Count: 2, Oldest: date(11, 4, 8), Newest: date(11, 5, 1)},
+			},
+		},
+		{
+			name:  "Nothing matches",
+			query: Query{Filter: Eq("Id", "z")},
+			want:  []Bucket{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, seed)
+			if tc.storeLocation != nil {
+				setStoreLocation(t, store, tc.storeLocation)
+			}
+
+			got, err := Aggregate(context.Background(), store, tc.query, tc.by...)
+			if err != nil {
+				t.Fatalf("Aggregate() error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Aggregate() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	store := newStore(t, fixedId, fixedClock, seed)
+	got, err := AggregateByQuery(context.Background(), store, map[string]string{"Status": "Done", "GroupBy": "UpdatedAt:day"})
+	if err != nil {
+		t.Fatalf("AggregateByQuery() error %v", err)
+	}
+	if len(got) != 2 || !reflect.DeepEqual(got[1].Key, []string{"2024-11-03"}) {
+		t.Errorf("AggregateByQuery() = %+v, want a bucket for 2024-10-30 and one for 2024-11-03", got)
+	}
+
+	for _, query := range []map[string]string{{"GroupBy": "Priority"}, {"GroupBy": "Status,Status"}, {"GroupBy": "CreatedAt:year"}, {"Status": "Maybe"}} {
+		if _, err := AggregateByQuery(context.Background(), store, query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("AggregateByQuery(%v) error %v, want ErrInvalidQuery", query, err)
+		}
+	}
+}
+
+func testStoreRecords(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+	store := newStore(t, fixedId, fixedClock, seed)
+
+	got, err := FetchRecords(context.Background(), store, Query{SortBy: "Id", Sort: "desc"}, "Id", "Description", "Status")
+	if err != nil {
+		t.Fatalf("FetchRecords() error %v", err)
+	}
+	fields := []string{"Id", "Description", "Status"}
+	want := []Record{
+		{Fields: fields, Values: []any{"1235", "Description 1235", StatusNotDone}},
+		{Fields: fields, Values: []any{"1234", "Description 1234", StatusDone}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchRecords() = %v, want %v", got, want)
+	}
+
+	got, err = FetchRecordsByQuery(context.Background(), store, map[string]string{"Status": "Done", "Fields": "Version,CreatedAt"})
+	if err != nil {
+		t.Fatalf("FetchRecordsByQuery() error %v", err)
+	}
+	want = []Record{{Fields: []string{"Version", "CreatedAt"}, Values: []any{int64(1), seed[0].CreatedAt}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchRecordsByQuery() = %v, want %v", got, want)
+	}
+
+	got, err = FetchRecords(context.Background(), store, Query{Filter: Eq("Id", "1234")})
+	if err != nil {
+		t.Fatalf("FetchRecords() error %v", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Fields, []string{"Id", "Description", "Status", "CreatedAt", "UpdatedAt", "Version"}) {
+		t.Errorf("FetchRecords() without fields = %v, want every field", got)
+	}
+
+	for _, query := range []map[string]string{{"Fields": "Id,Priority"}, {"Fields": "Id,Id"}, {"Fields": ""}, {"Status": "Maybe"}} {
+		if _, err := FetchRecordsByQuery(context.Background(), store, query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("FetchRecordsByQuery(%v) error %v, want ErrInvalidQuery", query, err)
+		}
+	}
+}
+
+func testStoreBulk(t *testing.T, newStore newStoreFunc) {
+	ctx := context.Background()
+	seed := conformanceSeed()
+	seed = append(seed, TodoEntity{
+		Entity: Entity{Id: "1236", CreatedAt: time.Date(2024, 11, 8, 0, 0, 0, 0, time.UTC), Version: 1},
+		Todo:   Todo{Description: "Other 1236", Status: StatusNotDone},
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+
+		query := map[string]string{"Description_contains": "Description", "SortBy": "Id", "Sort": "asc"}
+		got, err := UpdateByQuery(ctx, store, query, Todo{Status: StatusDone}, false)
+		if err != nil {
+			t.Fatalf("UpdateByQuery() error %v", err)
+		}
+		if got.Count != 2 || !reflect.DeepEqual(got.Ids, []string{"1234", "1235"}) {
+			t.Errorf("UpdateByQuery() = %v %v, want 2 [1234 1235]", got.Count, got.Ids)
+		}
+		for _, entity := range got.Todos {
+			if entity.Status != StatusDone || entity.Version != 2 || !entity.UpdatedAt.Equal(fixedClock()) {
+				t.Errorf("UpdateByQuery() todo = %v, want updated", entity)
+			}
+		}
+
+		todos, _ := store.FetchByQuery(map[string]string{"Status": "Done", "SortBy": "Id", "Sort": "asc"})
+		if !reflect.DeepEqual(ids(todos), []string{"1234", "1235"}) {
+			t.Errorf("FetchByQuery() after UpdateByQuery() = %v, want [1234 1235]", ids(todos))
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+
+		got, err := DeleteByFilter(ctx, store, Query{Filter: Eq("Status", "NotDone"), SortBy: "Id", Sort: "desc"}, false)
+		if err != nil {
+			t.Fatalf("DeleteByFilter() error %v", err)
+		}
+		if got.Count != 2 || !reflect.DeepEqual(got.Ids, []string{"1236", "1235"}) || got.Todos[1].Description != "Description 1235" {
+			t.Errorf("DeleteByFilter() = %v, want the deleted 1236 and 1235", got)
+		}
+
+		todos, _ := store.FetchAll()
+		if !reflect.DeepEqual(ids(todos), []string{"1234"}) {
+			t.Errorf("FetchAll() after DeleteByFilter() = %v, want [1234]", ids(todos))
+		}
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+		before, _ := store.FetchAll()
+
+		updated, err := UpdateByQuery(ctx, store, map[string]string{"Status": "NotDone"}, Todo{Description: "Renamed"}, true)
+		if err != nil {
+			t.Fatalf("UpdateByQuery() dry run error %v", err)
+		}
+		if updated.Count != 2 || updated.Todos[0].Description != "Renamed" {
+			t.Errorf("UpdateByQuery() dry run = %v, want the 2 renamed todos", updated)
+		}
+
+		deleted, err := DeleteByQuery(ctx, store, map[string]string{}, true)
+		if err != nil {
+			t.Fatalf("DeleteByQuery() dry run error %v", err)
+		}
+		if deleted.Count != 3 {
+			t.Errorf("DeleteByQuery() dry run count = %v, want 3", deleted.Count)
+		}
+
+		after, _ := store.FetchAll()
+		if !reflect.DeepEqual(after, before) {
+			t.Errorf("FetchAll() after dry runs = %v, want %v", after, before)
+		}
+	})
+
+	t.Run("No match", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+
+		got, err := DeleteByQuery(ctx, store, map[string]string{"Id": "missing"}, false)
+		if err != nil {
+			t.Fatalf("DeleteByQuery() error %v", err)
+		}
+		if got.Count != 0 || len(got.Ids) != 0 {
+			t.Errorf("DeleteByQuery() = %v, want no match", got)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+
+		if _, err := UpdateByQuery(ctx, store, map[string]string{}, Todo{}, false); !errors.Is(err, ErrValidation) {
+			t.Errorf("UpdateByQuery() with an empty patch error %v, want ErrValidation", err)
+		}
+		if _, err := DeleteByQuery(ctx, store, map[string]string{"Status": "Maybe"}, false); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("DeleteByQuery() with an invalid query error %v, want ErrInvalidQuery", err)
+		}
+
+		todos, _ := store.FetchAll()
+		if len(todos) != 3 {
+			t.Errorf("FetchAll() after failed bulk writes = %v todos, want 3", len(todos))
+		}
+	})
+}
+
+func testStoreWorkflow(t *testing.T, newStore newStoreFunc) {
+	ctx := context.Background()
+	store := newStore(t, sequenceId(), fixedClock, conformanceSeed())
+
+	if _, err := store.Insert(&Todo{Description: "Maybe", Status: "Maybe"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Insert() with an unknown status error %v, want ErrValidation", err)
+	}
+
+	blocked, err := store.Insert(&Todo{Description: "Blocked", Status: StatusBlocked})
+	if err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+
+	// 1235 is NotDone; it cannot skip InProgress on its way to InReview.
+	var transitionErr *TransitionError
+	if _, err := store.Update("1235", Todo{Status: StatusInReview}); !errors.As(err, &transitionErr) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("Update() from NotDone to InReview error %v, want a *TransitionError", err)
+	}
+	if transitionErr.Id != "1235" || transitionErr.From != StatusNotDone || transitionErr.To != StatusInReview {
+		t.Errorf("Update() error = %+v, want 1235 from NotDone to InReview", transitionErr)
+	}
+
+	for _, status := range []TodoStatus{StatusInProgress, StatusInReview, StatusDone, StatusNotDone, StatusCancelled} {
+		if _, err := store.Update("1235", Todo{Status: status}); err != nil {
+			t.Fatalf("Update() to %v error %v", status, err)
+		}
+	}
+
+	if _, err := store.Update("1235", Todo{Status: StatusNotDone}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Update() out of Cancelled error %v, want ErrValidation", err)
+	}
+	if _, err := store.Update("1235", Todo{Description: "Still cancelled", Status: StatusCancelled}); err != nil {
+		t.Errorf("Update() keeping Cancelled error %v", err)
+	}
+	if _, err := store.Update("1234", Todo{Status: "Maybe"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Update() to an unknown status error %v, want ErrValidation", err)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin() error %v", err)
+	}
+	if _, err := tx.Update(blocked.Id, Todo{Status: StatusDone}); !errors.Is(err, ErrValidation) {
+		t.Errorf("TodoTx.Update() from Blocked to Done error %v, want ErrValidation", err)
+	}
+	tx.Rollback()
+
+	// 1234 is Done, 1235 Cancelled and the inserted todo Blocked.
+	tests := []struct {
+		query map[string]string
+		want  []string
+	}{
+		{query: map[string]string{"Status": "open"}, want: []string{blocked.Id}},
+		{query: map[string]string{"Status": "closed", "SortBy": "Id", "Sort": "asc"}, want: []string{"1234", "1235"}},
+		{query: map[string]string{"Status": "Cancelled"}, want: []string{"1235"}},
+	}
+	for _, tc := range tests {
+		got, err := store.FetchByQuery(tc.query)
+		if err != nil {
+			t.Fatalf("FetchByQuery(%v) error %v", tc.query, err)
+		}
+		if !reflect.DeepEqual(ids(got), tc.want) {
+			t.Errorf("FetchByQuery(%v) = %v, want %v", tc.query, ids(got), tc.want)
+		}
+	}
+
+	got, err := store.FetchByFilter(Query{Filter: Not(Eq("Status", "open")), SortBy: "Id", Sort: "desc"})
+	if err != nil {
+		t.Fatalf("FetchByFilter() error %v", err)
+	}
+	if !reflect.DeepEqual(ids(got), []string{"1235", "1234"}) {
+		t.Errorf("FetchByFilter(not open) = %v, want [1235 1234]", ids(got))
+	}
+
+	got, err = FetchByQueryText(ctx, store, "status:Open or status:DONE")
+	if err != nil {
+		t.Fatalf("FetchByQueryText() error %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("FetchByQueryText(open or done) = %v, want 2 todos", ids(got))
+	}
+
+	if _, err := store.FetchByQuery(map[string]string{"Status": "archived"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("FetchByQuery() with an unknown group error %v, want ErrInvalidQuery", err)
+	}
+}
+
+func testStoreHistory(t *testing.T, newStore newStoreFunc) {
+	// The clock moves an hour every time it is read.
+	hour := 0
+	clock := func() time.Time {
+		hour++
+		return time.Date(2024, 11, 10, hour, 0, 0, 0, time.UTC)
+	}
+	at := func(hour int) time.Time {
+		return time.Date(2024, 11, 10, hour, 0, 0, 0, time.UTC)
+	}
+
+	store := newStore(t, fixedId, clock, []TodoEntity{})
+
+	todo, err := store.Insert(&Todo{Description: "Ship"})
+	if err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+	for _, model := range []Todo{{Status: StatusInProgress}, {Description: "Ship it"}, {Status: StatusInReview}, {Status: StatusDone}} {
+		if todo, err = store.Update(todo.Id, model); err != nil {
+			t.Fatalf("Update(%v) error %v", model, err)
+		}
+	}
+
+	want := []StatusChange{
+		{To: StatusNotDone, At: at(1)},
+		{From: StatusNotDone, To: StatusInProgress, At: at(2)},
+		{From: StatusInProgress, To: StatusInReview, At: at(4)},
+		{From: StatusInReview, To: StatusDone, At: at(5)},
+	}
+	if !reflect.DeepEqual(todo.History, want) || !todo.CompletedAt.Equal(at(5)) {
+		t.Errorf("Update() = %v completed at %v, want history %v completed at %v", todo.History, todo.CompletedAt, want, at(5))
+	}
+
+	todos, err := store.FetchByQuery(map[string]string{"Id": todo.Id})
+	if err != nil {
+		t.Fatalf("FetchByQuery() error %v", err)
+	}
+	if len(todos) != 1 || !reflect.DeepEqual(todos[0], *todo) {
+		t.Errorf("FetchByQuery() = %v, want %v", todos, *todo)
+	}
+	if cycle, _ := todos[0].CycleTime(); cycle != 3*time.Hour {
+		t.Errorf("CycleTime() = %v, want 3h", cycle)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin() error %v", err)
+	}
+	reopened, err := tx.Update(todo.Id, Todo{Status: StatusNotDone})
+	if err != nil {
+		t.Fatalf("TodoTx.Update() error %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error %v", err)
+	}
+	if last := reopened.History[len(reopened.History)-1]; !reopened.CompletedAt.IsZero() || len(reopened.History) != 5 || last.From != StatusDone || last.To != StatusNotDone || !last.At.After(at(5)) {
+		t.Errorf("TodoTx.Update() reopening = %v completed at %v, want a fifth change and no completion", reopened.History, reopened.CompletedAt)
+	}
+	// The update made in the transaction left the earlier copy alone.
+	if len(todo.History) != 4 {
+		t.Errorf("History of the earlier copy = %v, want 4 changes", todo.History)
+	}
+
+	todos, _ = store.FetchAll()
+	if len(todos) != 1 || !reflect.DeepEqual(todos[0], *reopened) {
+		t.Errorf("FetchAll() after Commit() = %v, want %v", todos, *reopened)
+	}
+}
+
+func testStorePatch(t *testing.T, newStore newStoreFunc) {
+	merge := func(ctx context.Context, ops TodoOperations, id string, patch string) (*TodoEntity, error) {
+		return MergePatch(ctx, ops, id, []byte(patch))
+	}
+	jsonPatch := func(ctx context.Context, ops TodoOperations, id string, patch string) (*TodoEntity, error) {
+		return JSONPatch(ctx, ops, id, []byte(patch))
+	}
+
+	tests := []struct {
+		apply   func(ctx context.Context, ops TodoOperations, id string, patch string) (*TodoEntity, error)
+		wantErr error
+		name    string
+		id      string
+		patch   string
+		want    Todo
+	}{
+		{name: "Merge patch", apply: merge, id: "1234", patch: `{"Description":"Patched","Id":"1234"}`, want: Todo{Description: "Patched", Status: StatusDone}},
+		{name: "Merge patch clears Status", apply: merge, id: "1234", patch: `{"Status":null}`, want: Todo{Description: "Description 1234", Status: StatusNotDone}},
+		{name: "JSON Patch", apply: jsonPatch, id: "1235", patch: `[{"op":"test","path":"/Version","value":1},{"op":"replace","path":"/Status","value":"Done"},{"op":"copy","from":"/Id","path":"/Description"}]`, want: Todo{Description: "1235", Status: StatusDone}},
+		{name: "JSON Patch removes Status", apply: jsonPatch, id: "1234", patch: `[{"op":"remove","path":"/Status"}]`, want: Todo{Description: "Description 1234", Status: StatusNotDone}},
+
+		{name: "Merge patch clears Description", apply: merge, id: "1234", patch: `{"Description":null}`, wantErr: ErrValidation},
+		{name: "Merge patch changes Id", apply: merge, id: "1234", patch: `{"Id":"1"}`, wantErr: ErrValidation},
+		{name: "Merge patch adds a field", apply: merge, id: "1234", patch: `{"Priority":"High"}`, wantErr: ErrValidation},
+		{name: "Merge patch sets a number", apply: merge, id: "1234", patch: `{"Description":1}`, wantErr: ErrValidation},
+		{name: "Merge patch replaces the todo", apply: merge, id: "1234", patch: `"todo"`, wantErr: ErrValidation},
+		{name: "Malformed merge patch", apply: merge, id: "1234", patch: `{`, wantErr: ErrInvalidPatch},
+		{name: "JSON Patch changes CreatedAt", apply: jsonPatch, id: "1234", patch: `[{"op":"replace","path":"/CreatedAt","value":"2024-01-01T00:00:00Z"}]`, wantErr: ErrValidation},
+		{name: "JSON Patch removes Version", apply: jsonPatch, id: "1234", patch: `[{"op":"remove","path":"/Version"}]`, wantErr: ErrValidation},
+		{name: "JSON Patch fails a test", apply: jsonPatch, id: "1234", patch: `[{"op":"replace","path":"/Status","value":"NotDone"},{"op":"test","path":"/Version","value":2}]`, wantErr: ErrInvalidPatch},
+		{name: "Missing todo", apply: jsonPatch, id: "1", patch: `[]`, wantErr: ErrNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			seed := conformanceSeed()
+			store := newStore(t, fixedId, fixedClock, seed)
+
+			got, err := tc.apply(context.Background(), store, tc.id, tc.patch)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("%v error %v, want %v", tc.name, err, tc.wantErr)
+				}
+				todos, _ := store.FetchAll()
+				if !reflect.DeepEqual(todos, seed) {
+					t.Errorf("FetchAll() after a failed patch = %v, want %v", todos, seed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v error %v", tc.name, err)
+			}
+			if got.Todo != tc.want || got.Id != tc.id || got.Version != 2 || !got.UpdatedAt.Equal(fixedClock()) {
+				t.Errorf("%v = %v, want %v at version 2", tc.name, got, tc.want)
+			}
+
+			todos, _ := store.FetchByQuery(map[string]string{"Id": tc.id})
+			if len(todos) != 1 || todos[0].Todo != tc.want {
+				t.Errorf("FetchByQuery() after %v = %v, want %v", tc.name, todos, tc.want)
+			}
+		})
+	}
+
+	t.Run("Concurrent write", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, conformanceSeed())
+		ops := &racingOps{TodoOperations: store}
+
+		if _, err := MergePatch(context.Background(), ops, "1234", []byte(`{"Status":"NotDone"}`)); !errors.Is(err, ErrConflict) {
+			t.Errorf("MergePatch() racing an update error %v, want ErrConflict", err)
+		}
+	})
+}
+
+// racingOps updates a todo right after it is fetched, as a concurrent
+// writer would.
+type racingOps struct {
+	TodoOperations
+}
+
+func (r *racingOps) FetchByFilterContext(ctx context.Context, query Query) ([]TodoEntity, error) {
+	todos, err := r.TodoOperations.FetchByFilterContext(ctx, query)
+	for _, todo := range todos {
+		r.TodoOperations.UpdateContext(ctx, todo.Id, Todo{Description: "Raced"})
+	}
+	return todos, err
+}
+
+func testStorePagination(t *testing.T, newStore newStoreFunc) {
+	at := func(id string, hour int) TodoEntity {
+		created := time.Date(2024, 11, 10, hour, 0, 0, 0, time.UTC)
+		return TodoEntity{
+			Entity: Entity{Id: id, CreatedAt: created, UpdatedAt: created, Version: 1},
+			Todo:   Todo{Description: "Todo " + id, Status: StatusNotDone},
+		}
+	}
+	// b, c and d share their CreatedAt.
+	a, b, c, d, e := at("a", 1), at("b", 2), at("c", 2), at("d", 2), at("e", 0)
+	seed := []TodoEntity{c, a, d, b, e}
+
+	pages := func(t *testing.T, store TodoStore, query Query, limit int) [][]TodoEntity {
+		var result [][]TodoEntity
+		cursor := ""
+		for {
+			page, err := FetchPage(context.Background(), store, query, limit, cursor)
+			if err != nil {
+				t.Fatalf("FetchPage() error %v", err)
+			}
+			if page.Total != len(seed) {
+				t.Errorf("FetchPage() Total = %v, want %v", page.Total, len(seed))
+			}
+			result = append(result, page.Todos)
+			if page.NextCursor == "" {
+				return result
+			}
+			cursor = page.NextCursor
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		limit int
+		want  [][]TodoEntity
+	}{
+		{
+			name:  "By CreatedAt with ties",
+			query: Query{SortBy: "CreatedAt", Sort: "asc"},
+			limit: 2,
+			want:  [][]TodoEntity{{e, a}, {b, c}, {d}},
+		},
+		{
+			name:  "By CreatedAt descending",
+			query: Query{SortBy: "CreatedAt", Sort: "desc"},
+			limit: 2,
+			want:  [][]TodoEntity{{d, c}, {b, a}, {e}},
+		},
+		{
+			name:  "By Id without a sort",
+			query: Query{},
+			limit: 3,
+			want:  [][]TodoEntity{{a, b, c}, {d, e}},
+		},
+		{
+			name:  "Exact pages",
+			query: Query{SortBy: "Description", Sort: "desc"},
+			limit: 5,
+			want:  [][]TodoEntity{{e, d, c, b, a}},
+		},
+		{
+			name:  "Without a limit",
+			query: Query{SortBy: "UpdatedAt", Sort: "asc"},
+			want:  [][]TodoEntity{{e, a, b, c, d}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, seed)
+
+			if got := pages(t, store, tc.query, tc.limit); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FetchPage() pages = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Writes between pages", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+		query := Query{Filter: Eq("Status", "NotDone"), SortBy: "CreatedAt", Sort: "asc"}
+
+		first, err := FetchPage(context.Background(), store, query, 2, "")
+		if err != nil {
+			t.Fatalf("FetchPage() error %v", err)
+		}
+		if _, err := store.Delete("b"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Update("a", Todo{Status: StatusDone}); err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := FetchPage(context.Background(), store, query, 2, first.NextCursor)
+		if err != nil {
+			t.Fatalf("FetchPage() error %v", err)
+		}
+		if !reflect.DeepEqual(second.Todos, []TodoEntity{c, d}) || second.NextCursor != "" || second.Total != 3 {
+			t.Errorf("FetchPage() = %+v, want c and d of 3 todos on the last page", second)
+		}
+	})
+
+	t.Run("Query map", func(t *testing.T) {
+		store := newStore(t, fixedId, fixedClock, seed)
+
+		first, err := FetchPageByQuery(context.Background(), store, map[string]string{"SortBy": "CreatedAt", "Sort": "desc", "Limit": "4"})
+		if err != nil {
+			t.Fatalf("FetchPageByQuery() error %v", err)
+		}
+		last, err := FetchPageByQuery(context.Background(), store, map[string]string{"SortBy": "CreatedAt", "Sort": "desc", "Limit": "4", "Cursor": first.NextCursor})
+		if err != nil {
+			t.Fatalf("FetchPageByQuery() error %v", err)
+		}
+		if !reflect.DeepEqual(first.Todos, []TodoEntity{d, c, b, a}) || !reflect.DeepEqual(last.Todos, []TodoEntity{e}) {
+			t.Errorf("FetchPageByQuery() pages = %v and %v", first.Todos, last.Todos)
+		}
+
+		invalid := []map[string]string{
+			{"Limit": "ten"},
+			{"Limit": "-1"},
+			{"Cursor": "not a cursor"},
+			{"Cursor": first.NextCursor},
+			{"Cursor": first.NextCursor, "SortBy": "CreatedAt", "Sort": "asc"},
+			{"Status": "Maybe", "Limit": "1"},
+		}
+		for _, query := range invalid {
+			if _, err := FetchPageByQuery(context.Background(), store, query); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("FetchPageByQuery(%v) error %v, want ErrInvalidQuery", query, err)
+			}
+		}
+	})
+}
+
+func testStoreUpdate(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+
+	tests := []struct {
+		want    *TodoEntity
+		model   Todo
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{
+			name:  "Update todo description",
+			id:    "1234",
+			model: Todo{Description: "New Description"},
+			want: &TodoEntity{
+				Entity{
+					Id:        "1234",
+					CreatedAt: seed[0].CreatedAt,
+					UpdatedAt: fixedClock(),
+					Version:   2,
+				},
+				Todo{
+					Description: "New Description",
+					Status:      StatusDone,
+				},
+			},
+		},
+		{
+			name:  "Update todo status",
+			id:    "1234",
+			model: Todo{Status: StatusNotDone},
+			want: &TodoEntity{
+				Entity{
+					Id:        "1234",
+					CreatedAt: seed[0].CreatedAt,
+					UpdatedAt: fixedClock(),
+					Version:   2,
+					History:   []StatusChange{{From: StatusDone, To: StatusNotDone, At: fixedClock()}},
+				},
+				Todo{
+					Description: "Description 1234",
+					Status:      StatusNotDone,
+				},
+			},
+		},
+		{
+			name:    "Update a entity with invalid id results in error",
+			id:      "12345",
+			model:   Todo{Description: "New Description"},
+			wantErr: true,
+		},
+		{
+			name:    "Update a entity with invalid model results in error",
+			id:      "1234",
+			model:   Todo{},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+			got, err := store.Update(tc.id, tc.model)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Update() error %v, wantsErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				all, _ := store.FetchAll()
+				if !reflect.DeepEqual(all, conformanceSeed()) {
+					t.Errorf("FetchAll() after failed Update = %v, want %v", all, conformanceSeed())
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Update() = %v, want %v", got, tc.want)
+			}
+
+			stored, err := store.FetchByQuery(map[string]string{"Id": tc.id})
+			if err != nil {
+				t.Fatalf("FetchByQuery() error %v", err)
+			}
+			if !reflect.DeepEqual(stored, []TodoEntity{*tc.want}) {
+				t.Errorf("FetchByQuery() after Update = %v, want %v", stored, []TodoEntity{*tc.want})
+			}
+		})
+	}
+}
+
+func testStoreDelete(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+
+	tests := []struct {
+		want    *TodoEntity
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{
+			name: "Delete a todo",
+			id:   "1234",
+			want: &seed[0],
+		},
+		{
+			name:    "Delete a todo with a invalid id",
+			id:      "12345",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+			got, err := store.Delete(tc.id)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Delete() error %v, wantsErr %v", err, tc.wantErr)
+			}
+
+			all, err2 := store.FetchAll()
+			if err2 != nil {
+				t.Fatalf("FetchAll() error %v", err2)
+			}
+
+			if err != nil {
+				if !reflect.DeepEqual(all, conformanceSeed()) {
+					t.Errorf("FetchAll() after failed Delete = %v, want %v", all, conformanceSeed())
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Delete() = %v, want %v", got, tc.want)
+			}
+
+			want := slices.DeleteFunc(conformanceSeed(), func(e TodoEntity) bool {
+				return e.Id == tc.id
+			})
+			if !reflect.DeepEqual(all, want) {
+				t.Errorf("FetchAll() after Delete = %v, want %v", all, want)
+			}
+		})
+	}
+}
+
+func TestTodoRepositoryConformance(t *testing.T) {
+	testTodoStore(t, func(t *testing.T, generateId GenerateId, clock Clock, seed []TodoEntity) TodoStore {
+		todoList := make([]TodoEntity, 0, len(seed))
+		todoList = append(todoList, seed...)
+
+		return &TodoRepository{
+			GenerateId: generateId,
+			Clock:      clock,
+			TodoList:   todoList,
+		}
+	})
+}
+
+func testStoreConditionalWrites(t *testing.T, newStore newStoreFunc) {
+	store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+	updated, err := store.UpdateIfVersion("1234", Todo{Status: StatusNotDone}, 1)
+	if err != nil {
+		t.Fatalf("UpdateIfVersion() error %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("UpdateIfVersion() version = %v, want 2", updated.Version)
+	}
+
+	_, err = store.UpdateIfVersion("1234", Todo{Description: "Stale"}, 1)
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("UpdateIfVersion() with a stale version error %v, want *VersionConflictError", err)
+	}
+	if conflict.Expected != 1 || conflict.Actual != 2 {
+		t.Errorf("UpdateIfVersion() conflict = %+v", conflict)
+	}
+
+	if _, err := store.DeleteIfVersion("1234", 1); !errors.As(err, &conflict) {
+		t.Fatalf("DeleteIfVersion() with a stale version error %v, want *VersionConflictError", err)
+	}
+
+	stored, _ := store.FetchByQuery(map[string]string{"Id": "1234"})
+	if !reflect.DeepEqual(stored, []TodoEntity{*updated}) {
+		t.Errorf("FetchByQuery() after conflicts = %v, want %v", stored, []TodoEntity{*updated})
+	}
+
+	if _, err := store.DeleteIfVersion("1234", 2); err != nil {
+		t.Fatalf("DeleteIfVersion() error %v", err)
+	}
+
+	if _, err := store.UpdateIfVersion("1234", Todo{Description: "Gone"}, 2); err == nil || errors.As(err, &conflict) {
+		t.Errorf("UpdateIfVersion() on a deleted todo error %v, want not found", err)
+	}
+}
+
+func testStoreIterators(t *testing.T, newStore newStoreFunc) {
+	seed := conformanceSeed()
+	store := newStore(t, fixedId, fixedClock, conformanceSeed())
+	ctx := context.Background()
+
+	var all []TodoEntity
+	for entity, err := range store.IterAll(ctx) {
+		if err != nil {
+			t.Fatalf("IterAll() error %v", err)
+		}
+		all = append(all, entity)
+	}
+	if !reflect.DeepEqual(all, seed) {
+		t.Errorf("IterAll() = %v, want %v", all, seed)
+	}
+
+	var sorted []TodoEntity
+	for entity, err := range store.IterByQuery(ctx, map[string]string{"SortBy": "CreatedAt", "Sort": "asc"}) {
+		if err != nil {
+			t.Fatalf("IterByQuery() error %v", err)
+		}
+		sorted = append(sorted, entity)
+	}
+	if !reflect.DeepEqual(sorted, []TodoEntity{seed[1], seed[0]}) {
+		t.Errorf("IterByQuery() sorted = %v, want %v", sorted, []TodoEntity{seed[1], seed[0]})
+	}
+
+	seen := 0
+	for _, err := range store.IterAll(ctx) {
+		if err != nil {
+			t.Fatalf("IterAll() error %v", err)
+		}
+		seen++
+		break
+	}
+	if seen != 1 {
+		t.Errorf("IterAll() yielded %v todos after break, want 1", seen)
+	}
+
+	// The store must still be usable once an iteration stopped early.
+	if _, err := store.Update("1234", Todo{Status: StatusNotDone}); err != nil {
+		t.Errorf("Update() after an early break error %v", err)
+	}
+
+	var iterErr error
+	for _, err := range store.IterByQuery(ctx, map[string]string{"Priority": "high"}) {
+		iterErr = err
+	}
+	if !errors.Is(iterErr, ErrInvalidQuery) {
+		t.Errorf("IterByQuery() error %v, want ErrInvalidQuery", iterErr)
+	}
+}
+
+func testStoreErrors(t *testing.T, newStore newStoreFunc) {
+	store := newStore(t, fixedId, fixedClock, conformanceSeed())
+
+	if _, err := store.Insert(&Todo{}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Insert() error %v, want ErrValidation", err)
+	}
+	if _, err := store.FetchByQuery(map[string]string{"Sort": "up", "SortBy": "Id"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("FetchByQuery() error %v, want ErrInvalidQuery", err)
+	}
+	if _, err := store.Update("1234", Todo{}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Update() error %v, want ErrValidation", err)
+	}
+	if _, err := store.Update("9999", Todo{Status: StatusDone}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() error %v, want ErrNotFound", err)
+	}
+	if _, err := store.Delete("9999"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() error %v, want ErrNotFound", err)
+	}
+	if _, err := store.DeleteIfVersion("1234", 7); !errors.Is(err, ErrConflict) {
+		t.Errorf("DeleteIfVersion() error %v, want ErrConflict", err)
+	}
+}
+
+func testStoreTransactions(t *testing.T, newStore newStoreFunc) {
+	t.Run("Commit applies every staged write", func(t *testing.T) {
+		store := newStore(t, sequenceId(), fixedClock, conformanceSeed())
+
+		tx, err := store.Begin()
+		if err != nil {
+			t.Fatalf("Begin() error %v", err)
+		}
+
+		for _, d := range []string{"First", "Second", "Third"} {
+			if _, err := tx.Insert(&Todo{Description: d}); err != nil {
+				t.Fatalf("tx.Insert() error %v", err)
+			}
+		}
+		if _, err := tx.Update("1235", Todo{Status: StatusDone}); err != nil {
+			t.Fatalf("tx.Update() error %v", err)
+		}
+		if _, err := tx.Delete("1234"); err != nil {
+			t.Fatalf("tx.Delete() error %v", err)
+		}
+
+		staged, err := tx.FetchByQuery(map[string]string{"Status": "Done"})
+		if err != nil {
+			t.Fatalf("tx.FetchByQuery() error %v", err)
+		}
+		if len(staged) != 1 || staged[0].Id != "1235" {
+			t.Errorf("tx.FetchByQuery() = %v, want the todo updated in the transaction", staged)
+		}
+
+		outside, _ := store.FetchAll()
+		if !reflect.DeepEqual(outside, conformanceSeed()) {
+			t.Errorf("FetchAll() before Commit = %v, want %v", outside, conformanceSeed())
+		}
+
+		want, _ := tx.FetchAll()
+
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() error %v", err)
+		}
+
+		got, _ := store.FetchAll()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FetchAll() after Commit = %v, want %v", got, want)
+		}
+
+		if _, err := tx.Insert(&Todo{Description: "Late"}); !errors.Is(err, ErrTxDone) {
+			t.Errorf("tx.Insert() after Commit error %v, want ErrTxDone", err)
+		}
+		if err := tx.Rollback(); !errors.Is(err, ErrTxDone) {
+			t.Errorf("Rollback() after Commit error %v, want ErrTxDone", err)
+		}
+	})
+
+	t.Run("Rollback discards every staged write", func(t *testing.T) {
+		store := newStore(t, sequenceId(), fixedClock, conformanceSeed())
+
+		tx, err := store.Begin()
+		if err != nil {
+			t.Fatalf("Begin() error %v", err)
+		}
+
+		if _, err := tx.Insert(&Todo{Description: "Discarded"}); err != nil {
+			t.Fatalf("tx.Insert() error %v", err)
+		}
+		if _, err := tx.Update("1234", Todo{Description: "Discarded"}); err != nil {
+			t.Fatalf("tx.Update() error %v", err)
+		}
+
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback() error %v", err)
+		}
+
+		got, _ := store.FetchAll()
+		if !reflect.DeepEqual(got, conformanceSeed()) {
+			t.Errorf("FetchAll() after Rollback = %v, want %v", got, conformanceSeed())
+		}
+	})
+}
+
+func testStoreCancellation(t *testing.T, newStore newStoreFunc) {
+	store := newStore(t, sequenceId(), fixedClock, conformanceSeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.InsertContext(ctx, &Todo{Description: "Cancelled"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("InsertContext() error %v, want context.Canceled", err)
+	}
+	if _, err := store.FetchAllContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchAllContext() error %v, want context.Canceled", err)
+	}
+	if _, err := store.FetchByQueryContext(ctx, map[string]string{"Status": "Done"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchByQueryContext() error %v, want context.Canceled", err)
+	}
+	if _, err := store.UpdateContext(ctx, "1234", Todo{Status: StatusNotDone}); !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateContext() error %v, want context.Canceled", err)
+	}
+	if _, err := store.DeleteContext(ctx, "1234"); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteContext() error %v, want context.Canceled", err)
+	}
+
+	got, _ := store.FetchAll()
+	if !reflect.DeepEqual(got, conformanceSeed()) {
+		t.Errorf("FetchAll() after cancelled writes = %v, want %v", got, conformanceSeed())
+	}
+
+	txCtx, txCancel := context.WithCancel(context.Background())
+	tx, err := store.BeginContext(txCtx)
+	if err != nil {
+		t.Fatalf("BeginContext() error %v", err)
+	}
+	if _, err := tx.Insert(&Todo{Description: "Staged"}); err != nil {
+		t.Fatalf("tx.Insert() error %v", err)
+	}
+	txCancel()
+
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Commit() after cancel expected an error")
+	}
+
+	got, _ = store.FetchAll()
+	if !reflect.DeepEqual(got, conformanceSeed()) {
+		t.Errorf("FetchAll() after a cancelled transaction = %v, want %v", got, conformanceSeed())
+	}
+}
+
+// testStoreConcurrency runs mixed CRUD from many goroutines. Run it with
+// -race to catch unsynchronized access.
+func testStoreConcurrency(t *testing.T, newStore newStoreFunc) {
+	const (
+		workers = 16
+		todos   = 20
+	)
+
+	var next atomic.Int64
+	generateId := func() string {
+		return strconv.FormatInt(next.Add(1), 10)
+	}
+
+	store := newStore(t, generateId, fixedClock, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < todos; i++ {
+				inserted, err := store.Insert(&Todo{Description: fmt.Sprintf("Worker %v todo %v", w, i)})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if _, err := store.Update(inserted.Id, Todo{Status: StatusDone}); err != nil {
+					errs <- err
+					return
+				}
+
+				if _, err := store.FetchByQuery(map[string]string{"Status": "Done", "SortBy": "Id", "Sort": "asc"}); err != nil {
+					errs <- err
+					return
+				}
+
+				if _, err := store.FetchAll(); err != nil {
+					errs <- err
+					return
+				}
+
+				if i%2 == 0 {
+					if _, err := store.Delete(inserted.Id); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent operation error %v", err)
+	}
+
+	all, err := store.FetchAll()
+	if err != nil {
+		t.Fatalf("FetchAll() error %v", err)
+	}
+
+	if len(all) != workers*todos/2 {
+		t.Errorf("FetchAll() returned %v todos, want %v", len(all), workers*todos/2)
+	}
+
+	for _, e := range all {
+		if e.Status != StatusDone {
+			t.Errorf("todo %v has status %v, want %v", e.Id, e.Status, StatusDone)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"time"
+)
+
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// repositoryTx is the TodoTx of a TodoRepository. Its writes go to a private
+// copy of the TodoList and are journaled as a single batch on Commit.
+type repositoryTx struct {
+	ctx  context.Context
+	repo *TodoRepository
+	view *TodoRepository
+	// versions holds the version of every todo when the transaction began.
+	versions  map[string]int64
+	mutations []Mutation
+	done      bool
+}
+
+// Begin starts a transaction. Commit fails with a *VersionConflictError if
+// a todo it writes was changed by someone else in the meantime.
+func (r *TodoRepository) Begin() (TodoTx, error) {
+	return r.BeginContext(context.Background())
+}
+
+func (r *TodoRepository) BeginContext(ctx context.Context) (TodoTx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := make(map[string]int64, len(r.TodoList))
+	for _, e := range r.TodoList {
+		versions[e.Id] = e.Version
+	}
+
+	tx := &repositoryTx{ctx: ctx, repo: r, versions: versions}
+	tx.view = &TodoRepository{
+		GenerateId: func() string {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return r.GenerateId()
+		},
+		Clock:    r.Clock,
+		Location: r.Location,
+		Workflow: r.Workflow,
+		Journal:  tx.stage,
+		TodoList: slices.Clone(r.TodoList),
+	}
+
+	return tx, nil
+}
+
+func (tx *repositoryTx) stage(mutations []Mutation) error {
+	tx.mutations = append(tx.mutations, mutations...)
+	return nil
+}
+
+func (tx *repositoryTx) workflow() *Workflow {
+	return tx.view.workflow()
+}
+
+func (tx *repositoryTx) location() *time.Location {
+	return tx.view.location()
+}
+
+func (tx *repositoryTx) Insert(todo *Todo) (*TodoEntity, error) {
+	return tx.InsertContext(tx.ctx, todo)
+}
+
+func (tx *repositoryTx) InsertContext(ctx context.Context, todo *Todo) (*TodoEntity, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.InsertContext(ctx, todo)
+}
+
+func (tx *repositoryTx) FetchAll() ([]TodoEntity, error) {
+	return tx.FetchAllContext(tx.ctx)
+}
+
+func (tx *repositoryTx) FetchAllContext(ctx context.Context) ([]TodoEntity, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.FetchAllContext(ctx)
+}
+
+func (tx *repositoryTx) FetchByQuery(query map[string]string) ([]TodoEntity, error) {
+	return tx.FetchByQueryContext(tx.ctx, query)
+}
+
+func (tx *repositoryTx) FetchByQueryContext(ctx context.Context, query map[string]string) ([]TodoEntity, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.FetchByQueryContext(ctx, query)
+}
+
+func (tx *repositoryTx) FetchByFilter(query Query) ([]TodoEntity, error) {
+	return tx.FetchByFilterContext(tx.ctx, query)
+}
+
+func (tx *repositoryTx) FetchByFilterContext(ctx context.Context, query Query) ([]TodoEntity, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.FetchByFilterContext(ctx, query)
+}
+
+func (tx *repositoryTx) IterAll(ctx context.Context) iter.Seq2[TodoEntity, error] {
+	return tx.IterByQuery(ctx, map[string]string{})
+}
+
+func (tx *repositoryTx) IterByQuery(ctx context.Context, query map[string]string) iter.Seq2[TodoEntity, error] {
+	if tx.done {
+		return func(yield func(TodoEntity, error) bool) {
+			yield(TodoEntity{}, ErrTxDone)
+		}
+	}
+	return tx.view.IterByQuery(ctx, query)
+}
+
+func (tx *repositoryTx) IterByFilter(ctx context.Context, query Query) iter.Seq2[TodoEntity, error] {
+	if tx.done {
+		return func(yield func(TodoEntity, error) bool) {
+			yield(TodoEntity{}, ErrTxDone)
+		}
+	}
+	return tx.view.IterByFilter(ctx, query)
+}
+
+func (tx *repositoryTx) Update(id string, model Todo) (*TodoEntity, error) {
+	return tx.UpdateIfVersionContext(tx.ctx, id, model, anyVersion)
+}
+
+func (tx *repositoryTx) UpdateContext(ctx context.Context, id string, model Todo) (*TodoEntity, error) {
+	return tx.UpdateIfVersionContext(ctx, id, model, anyVersion)
+}
+
+func (tx *repositoryTx) UpdateIfVersion(id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	return tx.UpdateIfVersionContext(tx.ctx, id, model, expectedVersion)
+}
+
+func (tx *repositoryTx) UpdateIfVersionContext(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.UpdateIfVersionContext(ctx, id, model, expectedVersion)
+}
+
+func (tx *repositoryTx) Delete(id string) (*TodoEntity, error) {
+	return tx.DeleteIfVersionContext(tx.ctx, id, anyVersion)
+}
+
+func (tx *repositoryTx) DeleteContext(ctx context.Context, id string) (*TodoEntity, error) {
+	return tx.DeleteIfVersionContext(ctx, id, anyVersion)
+}
+
+func (tx *repositoryTx) DeleteIfVersion(id string, expectedVersion int64) (*TodoEntity, error) {
+	return tx.DeleteIfVersionContext(tx.ctx, id, expectedVersion)
+}
+
+func (tx *repositoryTx) DeleteIfVersionContext(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.DeleteIfVersionContext(ctx, id, expectedVersion)
+}
+
+// Commit checks the staged writes against the current TodoList and applies
+// all of them, or none.
+func (tx *repositoryTx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	if len(tx.mutations) == 0 {
+		return nil
+	}
+
+	r := tx.repo
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := tx.validate(); err != nil {
+		return err
+	}
+
+	return r.commit(tx.ctx, tx.mutations...)
+}
+
+func (tx *repositoryTx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.mutations = nil
+
+	return nil
+}
+
+// validate verifies that every todo touched by the transaction is still at
+// the version it had when the transaction began. It must be called with the
+// repository write lock held.
+func (tx *repositoryTx) validate() error {
+	r := tx.repo
+	checked := make(map[string]bool)
+
+	for _, m := range tx.mutations {
+		id := m.Entity.Id
+		if checked[id] {
+			continue
+		}
+		checked[id] = true
+
+		idx := r.indexOf(id)
+		version, existed := tx.versions[id]
+
+		if !existed {
+			if idx >= 0 {
+				return &DuplicateIdError{Id: id}
+			}
+			continue
+		}
+
+		if idx < 0 {
+			return &NotFoundError{Id: id}
+		}
+
+		if err := checkVersion(&r.TodoList[idx], version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTodoRepositoryTxConflict(t *testing.T) {
+	tests := []struct {
+		stage   func(tx TodoTx) error
+		outside func(r *TodoRepository) error
+		name    string
+	}{
+		{
+			name: "Update of a todo changed outside the transaction",
+			stage: func(tx TodoTx) error {
+				_, err := tx.Update("1234", Todo{Description: "Inside"})
+				return err
+			},
+			outside: func(r *TodoRepository) error {
+				_, err := r.Update("1234", Todo{Description: "Outside"})
+				return err
+			},
+		},
+		{
+			name: "Delete of a todo changed outside the transaction",
+			stage: func(tx TodoTx) error {
+				_, err := tx.Delete("1234")
+				return err
+			},
+			outside: func(r *TodoRepository) error {
+				_, err := r.Update("1234", Todo{Status: StatusNotDone})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &TodoRepository{
+				GenerateId: sequenceId(),
+				Clock:      fixedClock,
+				TodoList:   conformanceSeed(),
+			}
+
+			tx, _ := r.Begin()
+			if _, err := tx.Insert(&Todo{Description: "Staged"}); err != nil {
+				t.Fatalf("tx.Insert() error %v", err)
+			}
+			if err := tc.stage(tx); err != nil {
+				t.Fatalf("staging error %v", err)
+			}
+
+			if err := tc.outside(r); err != nil {
+				t.Fatalf("outside write error %v", err)
+			}
+			want, _ := r.FetchAll()
+
+			var conflict *VersionConflictError
+			if err := tx.Commit(); !errors.As(err, &conflict) {
+				t.Fatalf("Commit() error %v, want *VersionConflictError", err)
+			}
+
+			got, _ := r.FetchAll()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FetchAll() after a conflicting Commit = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTodoRepositoryTxDuplicateId(t *testing.T) {
+	r := &TodoRepository{
+		GenerateId: fixedId,
+		Clock:      fixedClock,
+		TodoList:   make([]TodoEntity, 0),
+	}
+
+	tx, _ := r.Begin()
+	if _, err := tx.Insert(&Todo{Description: "Staged"}); err != nil {
+		t.Fatalf("tx.Insert() error %v", err)
+	}
+	if _, err := r.Insert(&Todo{Description: "Outside"}); err != nil {
+		t.Fatalf("Insert() error %v", err)
+	}
+
+	var duplicate *DuplicateIdError
+	err := tx.Commit()
+	if !errors.As(err, &duplicate) || !errors.Is(err, ErrConflict) {
+		t.Errorf("Commit() error %v, want a *DuplicateIdError", err)
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import "context"
+
+// anyVersion disables the version check of a conditional write.
+const anyVersion int64 = -1
+
+func checkVersion(entity *TodoEntity, expectedVersion int64) error {
+	if expectedVersion != anyVersion && entity.Version != expectedVersion {
+		return &VersionConflictError{
+			Id:       entity.Id,
+			Expected: expectedVersion,
+			Actual:   entity.Version,
+		}
+	}
+
+	return nil
+}
+
+// UpdateIfVersion updates the entity only if it is still at expectedVersion.
+func (r *TodoRepository) UpdateIfVersion(id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	return r.update(context.Background(), id, model, expectedVersion)
+}
+
+func (r *TodoRepository) UpdateIfVersionContext(ctx context.Context, id string, model Todo, expectedVersion int64) (*TodoEntity, error) {
+	return r.update(ctx, id, model, expectedVersion)
+}
+
+// DeleteIfVersion deletes the entity only if it is still at expectedVersion.
+func (r *TodoRepository) DeleteIfVersion(id string, expectedVersion int64) (*TodoEntity, error) {
+	return r.delete(context.Background(), id, expectedVersion)
+}
+
+func (r *TodoRepository) DeleteIfVersionContext(ctx context.Context, id string, expectedVersion int64) (*TodoEntity, error) {
+	return r.delete(ctx, id, expectedVersion)
+}
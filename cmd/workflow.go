@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Workflow is the state machine todo statuses follow. Insert only accepts
+// its States, Update only makes its Transitions, and queries match a Status
+// against a state or one of its Groups.
+//
+// A store validates its Workflow once, on the first write, so a Workflow
+// must not be changed after it is given to a store.
+type Workflow struct {
+	// States lists every status a todo can have. The first one is the
+	// status of a todo inserted without one.
+	States []TodoStatus
+	// Terminal lists the states a todo cannot leave.
+	Terminal []TodoStatus
+	// Completed lists the states that complete a todo: entering one of them
+	// sets its CompletedAt, and leaving them clears it.
+	Completed []TodoStatus
+	// Transitions lists the changes of status Update allows. Keeping the
+	// same status is not a transition.
+	Transitions []Transition
+	// Groups names sets of states that a query can match as a Status value,
+	// such as open and closed.
+	Groups map[string][]TodoStatus
+
+	// checked guards checkErr, the outcome of check.
+	checked  sync.Once
+	checkErr error
+}
+
+// Transition allows todos in the From state to move to the To state.
+type Transition struct {
+	From TodoStatus
+	To   TodoStatus
+	// Guard, when set, is given the todo before and after the update and
+	// refuses the transition by returning an error.
+	Guard func(current *TodoEntity, next *TodoEntity) error
+}
+
+// DefaultWorkflow is the workflow of stores without one. A todo can be
+// reopened once Done, but never once Cancelled.
+var DefaultWorkflow = &Workflow{
+	States:    []TodoStatus{StatusNotDone, StatusInProgress, StatusBlocked, StatusInReview, StatusDone, StatusCancelled},
+	Terminal:  []TodoStatus{StatusCancelled},
+	Completed: []TodoStatus{StatusDone},
+	Transitions: []Transition{
+		{From: StatusNotDone, To: StatusInProgress},
+		{From: StatusNotDone, To: StatusBlocked},
+		{From: StatusNotDone, To: StatusDone},
+		{From: StatusNotDone, To: StatusCancelled},
+		{From: StatusInProgress, To: StatusNotDone},
+		{From: StatusInProgress, To: StatusBlocked},
+		{From: StatusInProgress, To: StatusInReview},
+		{From: StatusInProgress, To: StatusDone},
+		{From: StatusInProgress, To: StatusCancelled},
+		{From: StatusBlocked, To: StatusNotDone},
+		{From: StatusBlocked, To: StatusInProgress},
+		{From: StatusBlocked, To: StatusCancelled},
+		{From: StatusInReview, To: StatusInProgress},
+		{From: StatusInReview, To: StatusDone},
+		{From: StatusInReview, To: StatusCancelled},
+		{From: StatusDone, To: StatusNotDone},
+	},
+	Groups: map[string][]TodoStatus{
+		"open":   {StatusNotDone, StatusInProgress, StatusBlocked, StatusInReview},
+		"closed": {StatusDone, StatusCancelled},
+	},
+}
+
+// orDefault returns w, or DefaultWorkflow if w is nil.
+func (w *Workflow) orDefault() *Workflow {
+	if w == nil {
+		return DefaultWorkflow
+	}
+
+	return w
+}
+
+// workflowOf returns the Workflow of the store behind ops.
+func workflowOf(ops TodoOperations) *Workflow {
+	if s, ok := ops.(interface{ workflow() *Workflow }); ok {
+		return s.workflow()
+	}
+
+	return DefaultWorkflow
+}
+
+// Validate reports the first inconsistency of w, such as a transition to an
+// unknown state or out of a terminal one.
+func (w *Workflow) Validate() error {
+	if len(w.States) == 0 {
+		return errors.New("A workflow needs at least one state")
+	}
+
+	for i, state := range w.States {
+		if state == "" {
+			return errors.New("A workflow state cannot be empty")
+		}
+		if slices.Contains(w.States[:i], state) {
+			return fmt.Errorf("State %v is listed twice", state)
+		}
+	}
+
+	for _, state := range w.Terminal {
+		if !w.HasState(state) {
+			return fmt.Errorf("Terminal state %v is not a state of the workflow", state)
+		}
+	}
+
+	for _, state := range w.Completed {
+		if !w.HasState(state) {
+			return fmt.Errorf("Completed state %v is not a state of the workflow", state)
+		}
+	}
+
+	for _, t := range w.Transitions {
+		if !w.HasState(t.From) || !w.HasState(t.To) {
+			return fmt.Errorf("Transition from %v to %v is between unknown states", t.From, t.To)
+		}
+		if slices.Contains(w.Terminal, t.From) {
+			return fmt.Errorf("Transition from %v to %v leaves a terminal state", t.From, t.To)
+		}
+	}
+
+	for name, states := range w.Groups {
+		if w.HasState(TodoStatus(name)) {
+			return fmt.Errorf("Group %v has the name of a state", name)
+		}
+		if len(states) == 0 {
+			return fmt.Errorf("Group %v has no states", name)
+		}
+		for _, state := range states {
+			if !w.HasState(state) {
+				return fmt.Errorf("Group %v holds %v, which is not a state of the workflow", name, state)
+			}
+		}
+	}
+
+	return nil
+}
+
+// check validates w before a todo is written with it, as stores take any
+// Workflow they are given. Only the first call runs Validate.
+func (w *Workflow) check() error {
+	w.checked.Do(func() {
+		if err := w.Validate(); err != nil {
+			w.checkErr = &ValidationError{Field: "Workflow", Message: fmt.Sprintf("Invalid workflow, %v", err)}
+		}
+	})
+
+	return w.checkErr
+}
+
+// HasState reports whether status is a state of w.
+func (w *Workflow) HasState(status TodoStatus) bool {
+	return slices.Contains(w.States, status)
+}
+
+// Next returns the states a todo in the from state can move to, ignoring
+// guards.
+func (w *Workflow) Next(from TodoStatus) []TodoStatus {
+	var next []TodoStatus
+	if slices.Contains(w.Terminal, from) {
+		return next
+	}
+
+	for _, t := range w.Transitions {
+		if t.From == from {
+			next = append(next, t.To)
+		}
+	}
+
+	return next
+}
+
+// queryValues returns the Status values a query accepts: the states and
+// then the groups, in order.
+func (w *Workflow) queryValues() []string {
+	values := make([]string, 0, len(w.States)+len(w.Groups))
+	for _, state := range w.States {
+		values = append(values, string(state))
+	}
+
+	return append(values, slices.Sorted(maps.Keys(w.Groups))...)
+}
+
+// checkStatus verifies that a todo can be written with status.
+func (w *Workflow) checkStatus(status TodoStatus) error {
+	if !w.HasState(status) {
+		return &ValidationError{
+			Field:   "Status",
+			Message: fmt.Sprintf("Invalid status %v, expected one of %v", status, joinStatuses(w.States)),
+		}
+	}
+
+	return nil
+}
+
+// transition verifies that a todo can be updated from current to next.
+func (w *Workflow) transition(current *TodoEntity, next *TodoEntity) error {
+	if current.Status == next.Status {
+		return nil
+	}
+
+	if err := w.checkStatus(next.Status); err != nil {
+		return err
+	}
+
+	refuse := func(err error) error {
+		return &TransitionError{Id: current.Id, From: current.Status, To: next.Status, Err: err}
+	}
+
+	if slices.Contains(w.Terminal, current.Status) {
+		return refuse(fmt.Errorf("%v is a terminal state", current.Status))
+	}
+
+	i := slices.IndexFunc(w.Transitions, func(t Transition) bool {
+		return t.From == current.Status && t.To == next.Status
+	})
+	if i < 0 {
+		return refuse(nil)
+	}
+
+	if guard := w.Transitions[i].Guard; guard != nil {
+		if err := guard(current, next); err != nil {
+			return refuse(err)
+		}
+	}
+
+	return nil
+}
+
+// record appends the change of entity from the from status to its current
+// one to its History, and sets or clears its CompletedAt.
+func (w *Workflow) record(entity *TodoEntity, from TodoStatus, at time.Time) {
+	// The History of entity may be shared with an older copy of the todo.
+	entity.History = append(slices.Clip(entity.History), StatusChange{From: from, To: entity.Status, At: at})
+
+	switch {
+	case !slices.Contains(w.Completed, entity.Status):
+		entity.CompletedAt = time.Time{}
+	case from == "" || !slices.Contains(w.Completed, from):
+		entity.CompletedAt = at
+	}
+}
+
+// expand replaces the Status comparisons of filter with a group value by an
+// OR of the states of the group.
+func (w *Workflow) expand(filter Filter) Filter {
+	switch f := filter.(type) {
+	case AndFilter:
+		filters := make([]Filter, len(f.Filters))
+		for i, child := range f.Filters {
+			filters[i] = w.expand(child)
+		}
+		return AndFilter{Filters: filters}
+	case OrFilter:
+		filters := make([]Filter, len(f.Filters))
+		for i, child := range f.Filters {
+			filters[i] = w.expand(child)
+		}
+		return OrFilter{Filters: filters}
+	case NotFilter:
+		return NotFilter{Filter: w.expand(f.Filter)}
+	case FieldFilter:
+		states, ok := w.Groups[f.Value]
+		if f.Field != "Status" || !ok {
+			return f
+		}
+		if len(states) == 1 {
+			return Eq("Status", string(states[0]))
+		}
+
+		filters := make([]Filter, len(states))
+		for i, state := range states {
+			filters[i] = Eq("Status", string(state))
+		}
+		return OrFilter{Filters: filters}
+	}
+
+	return filter
+}
+
+func joinStatuses(statuses []TodoStatus) string {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWorkflowValidate(t *testing.T) {
+	if err := DefaultWorkflow.Validate(); err != nil {
+		t.Errorf("DefaultWorkflow.Validate() error %v", err)
+	}
+
+	tests := []struct {
+		workflow *Workflow
+		name     string
+	}{
+		{name: "No states", workflow: &Workflow{}},
+		{name: "Empty state", workflow: &Workflow{States: []TodoStatus{"Todo", ""}}},
+		{name: "Duplicate state", workflow: &Workflow{States: []TodoStatus{"Todo", "Todo"}}},
+		{name: "Unknown terminal state", workflow: &Workflow{States: []TodoStatus{"Todo"}, Terminal: []TodoStatus{"Done"}}},
+		{name: "Unknown transition state", workflow: &Workflow{States: []TodoStatus{"Todo"}, Transitions: []Transition{{From: "Todo", To: "Done"}}}},
+		{
+			name: "Transition out of a terminal state",
+			workflow: &Workflow{
+				States:      []TodoStatus{"Todo", "Done"},
+				Terminal:    []TodoStatus{"Done"},
+				Transitions: []Transition{{From: "Done", To: "Todo"}},
+			},
+		},
+		{name: "Group named after a state", workflow: &Workflow{States: []TodoStatus{"Todo"}, Groups: map[string][]TodoStatus{"Todo": {"Todo"}}}},
+		{name: "Empty group", workflow: &Workflow{States: []TodoStatus{"Todo"}, Groups: map[string][]TodoStatus{"open": {}}}},
+		{name: "Unknown group state", workflow: &Workflow{States: []TodoStatus{"Todo"}, Groups: map[string][]TodoStatus{"open": {"Doing"}}}},
+	}
+
+	for _, tc := range tests {
+		if err := tc.workflow.Validate(); err == nil {
+			t.Errorf("Validate() of %v returned no error", tc.name)
+		}
+	}
+}
+
+func TestStoreInvalidWorkflow(t *testing.T) {
+	workflow := &Workflow{}
+	repository := &TodoRepository{GenerateId: sequenceId(), Clock: fixedClock, TodoList: conformanceSeed(), Workflow: workflow}
+	sqlStore := openTestSQLStore(t, sequenceId(), fixedClock)
+	sqlStore.Workflow = workflow
+	seed := conformanceSeed()
+	if err := insertSQLEntity(context.Background(), sqlStore.DB, &seed[0]); err != nil {
+		t.Fatalf("insertSQLEntity() error %v", err)
+	}
+
+	for name, store := range map[string]TodoStore{"TodoRepository": repository, "SQLStore": sqlStore} {
+		t.Run(name, func(t *testing.T) {
+			var validationErr *ValidationError
+			if _, err := store.Insert(&Todo{Description: "No status"}); !errors.As(err, &validationErr) || validationErr.Field != "Workflow" {
+				t.Errorf("Insert() with a workflow without states error %v, want a *ValidationError of the Workflow", err)
+			}
+			if _, err := store.Update("1234", Todo{Description: "Edited"}); !errors.As(err, &validationErr) || validationErr.Field != "Workflow" {
+				t.Errorf("Update() with a workflow without states error %v, want a *ValidationError of the Workflow", err)
+			}
+		})
+	}
+}
+
+func TestWorkflowNext(t *testing.T) {
+	tests := []struct {
+		from TodoStatus
+		want []TodoStatus
+	}{
+		{from: StatusBlocked, want: []TodoStatus{StatusNotDone, StatusInProgress, StatusCancelled}},
+		{from: StatusDone, want: []TodoStatus{StatusNotDone}},
+		{from: StatusCancelled, want: nil},
+		{from: "Maybe", want: nil},
+	}
+
+	for _, tc := range tests {
+		if got := DefaultWorkflow.Next(tc.from); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Next(%v) = %v, want %v", tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestStoreWorkflow(t *testing.T) {
+	errNoReviewer := errors.New("no reviewer")
+	workflow := &Workflow{
+		States: []TodoStatus{"Todo", "Doing", "Review", "Shipped"},
+		Transitions: []Transition{
+			{From: "Todo", To: "Doing"},
+			{From: "Doing", To: "Review", Guard: func(current *TodoEntity, next *TodoEntity) error {
+				if !strings.Contains(next.Description, "@") {
+					return errNoReviewer
+				}
+				return nil
+			}},
+			{From: "Review", To: "Shipped"},
+		},
+		Groups: map[string][]TodoStatus{"active": {"Doing", "Review"}},
+	}
+	if err := workflow.Validate(); err != nil {
+		t.Fatalf("Validate() error %v", err)
+	}
+
+	repository := &TodoRepository{GenerateId: sequenceId(), Clock: fixedClock, TodoList: make([]TodoEntity, 0), Workflow: workflow}
+	sqlStore := openTestSQLStore(t, sequenceId(), fixedClock)
+	sqlStore.Workflow = workflow
+
+	for name, store := range map[string]TodoStore{"TodoRepository": repository, "SQLStore": sqlStore} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			todo, err := store.Insert(&Todo{Description: "Ship it"})
+			if err != nil {
+				t.Fatalf("Insert() error %v", err)
+			}
+			if todo.Status != "Todo" {
+				t.Errorf("Insert() status = %v, want the first state Todo", todo.Status)
+			}
+			if _, err := store.Insert(&Todo{Description: "Done", Status: StatusDone}); !errors.Is(err, ErrValidation) {
+				t.Errorf("Insert() with a status of another workflow error %v, want ErrValidation", err)
+			}
+
+			if _, err := store.Update(todo.Id, Todo{Status: "Doing"}); err != nil {
+				t.Fatalf("Update() to Doing error %v", err)
+			}
+			if _, err := store.Update(todo.Id, Todo{Status: "Review"}); !errors.Is(err, errNoReviewer) || !errors.Is(err, ErrValidation) {
+				t.Errorf("Update() refused by a guard error %v, want errNoReviewer", err)
+			}
+			if _, err := MergePatch(ctx, store, todo.Id, []byte(`{"Description":"Ship it @ana","Status":"Review"}`)); err != nil {
+				t.Errorf("MergePatch() passing the guard error %v", err)
+			}
+
+			page, err := FetchPageByQuery(ctx, store, map[string]string{"Status": "active", "Limit": "1"})
+			if err != nil {
+				t.Fatalf("FetchPageByQuery() error %v", err)
+			}
+			if page.Total != 1 || page.Todos[0].Status != "Review" {
+				t.Errorf("FetchPageByQuery(active) = %v, want the todo in Review", page)
+			}
+
+			got, err := FetchByQueryText(ctx, store, "status:ACTIVE")
+			if err != nil || len(got) != 1 {
+				t.Errorf("FetchByQueryText(status:ACTIVE) = %v, %v, want the todo in Review", got, err)
+			}
+
+			if _, err := store.FetchByQuery(map[string]string{"Status": "open"}); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("FetchByQuery() with a group of another workflow error %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}